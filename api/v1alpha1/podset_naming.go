@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bytes"
+	"text/template"
+
+	"k8s.io/api/core/v1"
+)
+
+// PodNameFields are the values a PodNameTemplate may refer to.
+// +kubebuilder:object:generate=false
+type PodNameFields struct {
+	// Name is the name of the PodSet.
+	Name string
+	// Index is the index of the pod within the PodSet.
+	Index int
+	// Zone is the zone the pod is pinned to, empty if any.
+	Zone string
+	// Revision is the revision of the pod template.
+	Revision string
+}
+
+// RenderPodName executes the pod name template with the given fields.
+func RenderPodName(nameTemplate string, fields PodNameFields) (string, error) {
+	tmpl, err := template.New("podName").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", err
+	}
+	var name bytes.Buffer
+	if err = tmpl.Execute(&name, fields); err != nil {
+		return "", err
+	}
+	return name.String(), nil
+}
+
+// PodNameDependsOnIndex returns true if the pods named after the template get a
+// different name for every index.
+func PodNameDependsOnIndex(nameTemplate string, fields PodNameFields) (bool, error) {
+	fields.Index = 0
+	first, err := RenderPodName(nameTemplate, fields)
+	if err != nil {
+		return false, err
+	}
+	fields.Index = 1
+	second, err := RenderPodName(nameTemplate, fields)
+	if err != nil {
+		return false, err
+	}
+	return first != second, nil
+}
+
+// GetPodZone returns the zone the pods of the template are pinned to by their node
+// selector or their required node affinity, empty if any.
+func GetPodZone(template *v1.PodTemplateSpec) string {
+	if zone, ok := template.Spec.NodeSelector[v1.LabelTopologyZone]; ok {
+		return zone
+	}
+	affinity := template.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+
+	// Every term has to pin the same zone.
+	var zone string
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		var termZone string
+		for _, requirement := range term.MatchExpressions {
+			if requirement.Key == v1.LabelTopologyZone && requirement.Operator == v1.NodeSelectorOpIn && len(requirement.Values) == 1 {
+				termZone = requirement.Values[0]
+			}
+		}
+		if len(termZone) == 0 || (len(zone) != 0 && termZone != zone) {
+			return ""
+		}
+		zone = termZone
+	}
+	return zone
+}
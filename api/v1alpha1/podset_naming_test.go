@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+)
+
+func TestRenderPodName(t *testing.T) {
+	fields := PodNameFields{Name: "web", Index: 3, Zone: "zone-a", Revision: "5d8f7"}
+	tests := []struct {
+		name         string
+		nameTemplate string
+		expected     string
+		expectErr    bool
+	}{
+		{name: "index", nameTemplate: "{{.Name}}-{{.Index}}", expected: "web-3"},
+		{name: "all fields", nameTemplate: "{{.Name}}-{{.Zone}}-{{.Revision}}-{{.Index}}", expected: "web-zone-a-5d8f7-3"},
+		{name: "literal", nameTemplate: "web", expected: "web"},
+		{name: "unknown field", nameTemplate: "{{.Namespace}}-{{.Index}}", expectErr: true},
+		{name: "malformed template", nameTemplate: "{{.Name", expectErr: true},
+	}
+
+	for _, test := range tests {
+		name, err := RenderPodName(test.nameTemplate, fields)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %q", test.name, name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if name != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, name)
+		}
+	}
+}
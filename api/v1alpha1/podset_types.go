@@ -17,8 +17,11 @@ limitations under the License.
 package v1alpha1
 
 import (
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // PodSetSpec defines the desired state of PodSet
@@ -32,9 +35,439 @@ type PodSetSpec struct {
 	// Template describes the pods that will be created.
 	Template v1.PodTemplateSpec `json:"template" protobuf:"bytes,3,opt,name=template"`
 
-	// Indicates that the PodSet is paused.
+	// Indicates that the PodSet is paused. A paused PodSet freezes rollouts of
+	// its pods but keeps managing the number of replicas.
 	// +optional
 	Paused bool `json:"paused,omitempty" protobuf:"varint,7,opt,name=paused"`
+
+	// Suspend scales the PodSet down to zero pods while keeping the configured
+	// replicas, which are restored once the PodSet is resumed.
+	// Defaults to false.
+	// +optional
+	Suspend *bool `json:"suspend,omitempty" protobuf:"varint,8,opt,name=suspend"`
+
+	// Burst is the maximum number of pods of the PodSet created or deleted at once,
+	// the operations are refilled at the rate configured on the manager.
+	// Defaults to the burst configured on the manager.
+	// +optional
+	Burst *int32 `json:"burst,omitempty" protobuf:"varint,9,opt,name=burst"`
+
+	// PodManagement controls how the pods of the PodSet are identified.
+	// +optional
+	PodManagement PodManagement `json:"podManagement,omitempty" protobuf:"bytes,10,opt,name=podManagement"`
+
+	// PodManagementPolicy controls the order in which the pods of an ordinal PodSet are
+	// created and deleted, one of OrderedReady or Parallel. Defaults to Parallel.
+	// +optional
+	PodManagementPolicy PodManagementPolicyType `json:"podManagementPolicy,omitempty" protobuf:"bytes,13,opt,name=podManagementPolicy,casttype=PodManagementPolicyType"`
+
+	// VolumeClaimTemplates is a list of claims that the pods of an ordinal PodSet are
+	// allowed to reference. Every pod gets its own claims, named
+	// <template-name>-<podset-name>-<ordinal>, which are attached again when the pod
+	// of the same ordinal is recreated. A claim template must have the same name as
+	// a volume of the pod template to replace it, otherwise it is added to the pod volumes.
+	// +optional
+	VolumeClaimTemplates []v1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty" protobuf:"bytes,11,rep,name=volumeClaimTemplates"`
+
+	// PersistentVolumeClaimRetentionPolicy describes what happens to the claims created
+	// from VolumeClaimTemplates when their pods are scaled down or the PodSet is deleted.
+	// By default all the claims are retained.
+	// +optional
+	PersistentVolumeClaimRetentionPolicy *PodSetPersistentVolumeClaimRetentionPolicy `json:"persistentVolumeClaimRetentionPolicy,omitempty" protobuf:"bytes,12,opt,name=persistentVolumeClaimRetentionPolicy"`
+
+	// Overrides patch the template of the pods they select in an ordinal PodSet. The
+	// overrides are applied in order, a pod is rolled only when the overrides selecting it
+	// change. Changes of the base template are picked up by the new pods.
+	// +optional
+	Overrides []PodSetOverride `json:"overrides,omitempty" protobuf:"bytes,14,rep,name=overrides"`
+
+	// ReshardPolicy controls which pods are replaced when the replicas change, so that
+	// the PODSET_INDEX and PODSET_REPLICAS environment variables injected in the pods
+	// are up to date. One of RestartAll or NewPodsOnly, defaults to NewPodsOnly.
+	// +optional
+	ReshardPolicy ReshardPolicyType `json:"reshardPolicy,omitempty" protobuf:"bytes,15,opt,name=reshardPolicy,casttype=ReshardPolicyType"`
+
+	// PodNameTemplate is a Go template naming the pods of the PodSet, which may refer
+	// to {{.Name}}, the name of the PodSet, {{.Index}}, the index of the pod, {{.Zone}},
+	// the zone the pod is pinned to, and {{.Revision}}, the revision of the pod template.
+	// The pods of an ordinal PodSet are named after the template, which must depend on
+	// the index, while the pods of a random PodSet get a random suffix appended to it.
+	// Defaults to <podset-name>-<ordinal> for ordinal PodSets and to a random suffix
+	// appended to the PodSet name otherwise.
+	// +optional
+	PodNameTemplate string `json:"podNameTemplate,omitempty" protobuf:"bytes,16,opt,name=podNameTemplate"`
+
+	// DeletionPolicy controls what happens to the pods when the PodSet is deleted. One
+	// of Delete, the pods are garbage collected with the PodSet, or Orphan, the pods
+	// keep running without controller. Defaults to Delete.
+	// +optional
+	DeletionPolicy DeletionPolicyType `json:"deletionPolicy,omitempty" protobuf:"bytes,17,opt,name=deletionPolicy,casttype=DeletionPolicyType"`
+
+	// Teardown drains the pods of the PodSet in batches when it is deleted, instead of
+	// letting them be garbage collected all at once. It cannot be combined with the
+	// Orphan deletion policy, and foreground deletions remove the pods beforehand.
+	// +optional
+	Teardown *PodSetTeardown `json:"teardown,omitempty" protobuf:"bytes,18,opt,name=teardown"`
+
+	// PendingTimeoutSeconds is how long a pod may stay unscheduled, or scheduled with
+	// its containers being created, before it is deleted and replaced by a pod which
+	// may land elsewhere. Pods are never replaced for being pending by default.
+	// +optional
+	PendingTimeoutSeconds *int32 `json:"pendingTimeoutSeconds,omitempty" protobuf:"varint,19,opt,name=pendingTimeoutSeconds"`
+
+	// ForceDeletion force deletes the pods stuck terminating on an unreachable node,
+	// so that an ordinal PodSet can reuse their identity. Pods are never force deleted
+	// by default.
+	// +optional
+	ForceDeletion *PodSetForceDeletion `json:"forceDeletion,omitempty" protobuf:"bytes,20,opt,name=forceDeletion"`
+
+	// NodeFailurePolicy controls what happens to the pods of a failed node, that is a
+	// node NotReady or tainted unreachable. One of Wait, the pods are replaced once
+	// evicted, or Surge, replacement pods are created elsewhere right away and the
+	// extra pods are removed once the failed pods are evicted or their node recovers.
+	// Surge is only supported by PodSets with a Random identity. Defaults to Wait.
+	// +optional
+	NodeFailurePolicy NodeFailurePolicyType `json:"nodeFailurePolicy,omitempty" protobuf:"bytes,21,opt,name=nodeFailurePolicy,casttype=NodeFailurePolicyType"`
+
+	// HealthPolicy replaces the pods running but not ready for too long, like pods
+	// wedged with failing readiness probes which their liveness probes tolerate.
+	// Pods are never replaced for being not ready by default.
+	// +optional
+	HealthPolicy *PodSetHealthPolicy `json:"healthPolicy,omitempty" protobuf:"bytes,22,opt,name=healthPolicy"`
+
+	// TerminatedPodRetention bounds the succeeded and failed pods of the PodSet kept
+	// for debugging, the most recent ones are kept and the others deleted. Terminated
+	// pods are left to the garbage collector of the cluster by default.
+	// +optional
+	TerminatedPodRetention *PodSetTerminatedPodRetention `json:"terminatedPodRetention,omitempty" protobuf:"bytes,23,opt,name=terminatedPodRetention"`
+
+	// Topology spreads the pods of the PodSet across the domains of a topology, like
+	// zones, and keeps them spread across scale operations. Every pod is pinned to its
+	// domain by a required node affinity, and the pods of an ordinal PodSet keep the
+	// domain of their ordinal.
+	// +optional
+	Topology *PodSetTopology `json:"topology,omitempty" protobuf:"bytes,24,opt,name=topology"`
+
+	// AntiAffinity keeps the pods of the PodSet apart by adding a pod anti-affinity
+	// term selecting them to the affinity of the pod template. One of Soft, the pods
+	// are preferably scheduled apart, Hard, the pods are required to be scheduled
+	// apart, or None. Defaults to None.
+	// +optional
+	AntiAffinity AntiAffinityType `json:"antiAffinity,omitempty" protobuf:"bytes,25,opt,name=antiAffinity,casttype=AntiAffinityType"`
+
+	// AntiAffinityTopologyKey is the node label whose values the pods are kept apart
+	// across. Defaults to kubernetes.io/hostname, that is distinct nodes.
+	// +optional
+	AntiAffinityTopologyKey string `json:"antiAffinityTopologyKey,omitempty" protobuf:"bytes,26,opt,name=antiAffinityTopologyKey"`
+
+	// Subsets split the pods of the PodSet into variants of the pod template, like
+	// spot and on-demand capacity, each given a share of the replicas. A subset whose
+	// pods stay unschedulable longer than the pending timeout, or 5 minutes without
+	// one, takes no more pods and the next subsets get them meanwhile. Subsets are only
+	// supported by PodSets with a Random identity and cannot be combined with a
+	// topology.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Subsets []PodSetSubset `json:"subsets,omitempty" protobuf:"bytes,27,rep,name=subsets"`
+
+	// Gang schedules the pods of the PodSet all or nothing, through a PodGroup of the
+	// coscheduling plugin of the scheduler-plugins project, which holds the pods until
+	// enough of them can be scheduled at once. The pod template has to name a scheduler
+	// running the plugin. All the pods are deleted and recreated if the gang does not
+	// run within its timeout.
+	// +optional
+	Gang *PodSetGang `json:"gang,omitempty" protobuf:"bytes,28,opt,name=gang"`
+}
+
+// PodSetGang describes the gang of the pods of a PodSet.
+type PodSetGang struct {
+	// MinMember is the number of pods scheduled together, the gang runs once as many
+	// pods are running. Defaults to the replicas.
+	// +optional
+	MinMember *int32 `json:"minMember,omitempty" protobuf:"varint,1,opt,name=minMember"`
+
+	// TimeoutSeconds is how long the gang may wait for its pods to run, before all of
+	// them are deleted and recreated.
+	TimeoutSeconds int32 `json:"timeoutSeconds" protobuf:"varint,2,opt,name=timeoutSeconds"`
+}
+
+// PodSetSubset is a variant of the pod template given a share of the replicas.
+type PodSetSubset struct {
+	// Name is the name of the subset, the pods of the subset are labeled with it.
+	Name string `json:"name" protobuf:"bytes,1,opt,name=name"`
+
+	// Patch is a strategic merge patch applied to the pod template of the subset.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Patch runtime.RawExtension `json:"patch,omitempty" protobuf:"bytes,2,opt,name=patch"`
+
+	// Replicas is the share of the replicas of the subset, either a number or a
+	// percentage of the replicas rounded down. The replicas left are shared by the
+	// subsets without replicas, or given to the last subset if all have replicas.
+	// +optional
+	Replicas *intstr.IntOrString `json:"replicas,omitempty" protobuf:"bytes,3,opt,name=replicas"`
+
+	// MaxReplicas is the maximum number of pods of the subset, the pods above it go
+	// to the next subsets.
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty" protobuf:"varint,4,opt,name=maxReplicas"`
+}
+
+// AntiAffinityType defines how strictly the pods of a PodSet are kept apart.
+// +kubebuilder:validation:Enum=Soft;Hard;None
+type AntiAffinityType string
+
+const (
+	// SoftAntiAffinity prefers scheduling the pods of a PodSet apart.
+	SoftAntiAffinity AntiAffinityType = "Soft"
+
+	// HardAntiAffinity requires scheduling the pods of a PodSet apart.
+	HardAntiAffinity AntiAffinityType = "Hard"
+
+	// NoAntiAffinity leaves the affinity of the pods as is.
+	NoAntiAffinity AntiAffinityType = "None"
+)
+
+// PodSetTopology describes how the pods of a PodSet are spread across domains.
+type PodSetTopology struct {
+	// TopologyKey is the node label whose values are the domains. Defaults to
+	// topology.kubernetes.io/zone.
+	// +optional
+	TopologyKey string `json:"topologyKey,omitempty" protobuf:"bytes,1,opt,name=topologyKey"`
+
+	// Domains are the domains the pods are spread across, in proportion to their
+	// weights.
+	// +listType=map
+	// +listMapKey=name
+	Domains []PodSetTopologyDomain `json:"domains" protobuf:"bytes,2,rep,name=domains"`
+}
+
+// PodSetTopologyDomain is a domain the pods of a PodSet are spread across.
+type PodSetTopologyDomain struct {
+	// Name is the value of the topology key of the nodes of the domain.
+	Name string `json:"name" protobuf:"bytes,1,opt,name=name"`
+
+	// Weight is the share of the replicas given to the domain, relative to the other
+	// domains. Defaults to 1, so that the pods are spread evenly.
+	// +optional
+	Weight *int32 `json:"weight,omitempty" protobuf:"varint,2,opt,name=weight"`
+}
+
+// PodSetTerminatedPodRetention describes which terminated pods of a PodSet are kept.
+// The failed pods of a crash looping PodSet are kept while they back off the creation
+// of new pods.
+type PodSetTerminatedPodRetention struct {
+	// MaxCount is the maximum number of terminated pods kept, the most recently
+	// terminated first.
+	// +optional
+	MaxCount *int32 `json:"maxCount,omitempty" protobuf:"varint,1,opt,name=maxCount"`
+
+	// MaxAgeSeconds is how long a pod is kept once terminated.
+	// +optional
+	MaxAgeSeconds *int32 `json:"maxAgeSeconds,omitempty" protobuf:"varint,2,opt,name=maxAgeSeconds"`
+}
+
+// PodSetHealthPolicy describes when the not ready pods of a PodSet are replaced.
+type PodSetHealthPolicy struct {
+	// MaxNotReadySeconds is how long a running pod may stay not ready before it is
+	// deleted and replaced.
+	MaxNotReadySeconds int32 `json:"maxNotReadySeconds" protobuf:"varint,1,opt,name=maxNotReadySeconds"`
+
+	// MaxConcurrentHeals is the maximum number of pods replaced at once, either a
+	// number or a percentage of the replicas rounded up. The not ready pods not yet
+	// past MaxNotReadySeconds and the missing pods count against it, so that an outage
+	// of all the pods does not replace them all. Defaults to 1.
+	// +optional
+	MaxConcurrentHeals *intstr.IntOrString `json:"maxConcurrentHeals,omitempty" protobuf:"bytes,2,opt,name=maxConcurrentHeals"`
+}
+
+// NodeFailurePolicyType defines what happens to the pods of a failed node.
+// +kubebuilder:validation:Enum=Wait;Surge
+type NodeFailurePolicyType string
+
+const (
+	// WaitNodeFailurePolicy replaces the pods of a failed node once they are evicted.
+	WaitNodeFailurePolicy NodeFailurePolicyType = "Wait"
+
+	// SurgeNodeFailurePolicy replaces the pods of a failed node before they are evicted.
+	SurgeNodeFailurePolicy NodeFailurePolicyType = "Surge"
+)
+
+// PodSetForceDeletion describes when the terminating pods of a PodSet are force deleted.
+type PodSetForceDeletion struct {
+	// NodeNotReadySeconds is how long the node of a pod past its grace period has to be
+	// NotReady, or unreachable, before the pod is force deleted. A pod whose node is
+	// gone is force deleted once past its grace period.
+	NodeNotReadySeconds int32 `json:"nodeNotReadySeconds" protobuf:"varint,1,opt,name=nodeNotReadySeconds"`
+}
+
+// PodSetTeardown describes how the pods of a deleted PodSet are removed.
+type PodSetTeardown struct {
+	// MaxUnavailable is the maximum number of pods unavailable during the teardown,
+	// either a number or a percentage of the replicas rounded down. The pods are
+	// deleted in batches of at most as many pods, the unavailable pods first.
+	// Defaults to 1.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty" protobuf:"bytes,1,opt,name=maxUnavailable"`
+
+	// PreDeleteHook is a Job run to completion before the first pod is deleted. A
+	// failed Job does not prevent the teardown.
+	// +optional
+	PreDeleteHook *batchv1.JobTemplateSpec `json:"preDeleteHook,omitempty" protobuf:"bytes,2,opt,name=preDeleteHook"`
+}
+
+// PreDeleteHookPhase is the phase of the pre-delete hook Job of a deleted PodSet.
+type PreDeleteHookPhase string
+
+const (
+	// PreDeleteHookRunning means the teardown waits for the Job to finish.
+	PreDeleteHookRunning PreDeleteHookPhase = "Running"
+
+	// PreDeleteHookSucceeded means the Job completed.
+	PreDeleteHookSucceeded PreDeleteHookPhase = "Succeeded"
+
+	// PreDeleteHookFailed means the Job failed, the pods are drained anyway.
+	PreDeleteHookFailed PreDeleteHookPhase = "Failed"
+)
+
+// PodSetTeardownStatus reports the progress of the teardown of a deleted PodSet.
+type PodSetTeardownStatus struct {
+	// PreDeleteHook is the phase of the pre-delete hook Job, empty without hook.
+	// +optional
+	PreDeleteHook PreDeleteHookPhase `json:"preDeleteHook,omitempty" protobuf:"bytes,1,opt,name=preDeleteHook,casttype=PreDeleteHookPhase"`
+
+	// Replicas is the number of pods of the PodSet when the teardown started.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty" protobuf:"varint,2,opt,name=replicas"`
+
+	// DrainedReplicas is the number of those pods deleted or being deleted.
+	// +optional
+	DrainedReplicas int32 `json:"drainedReplicas,omitempty" protobuf:"varint,3,opt,name=drainedReplicas"`
+
+	// RemainingReplicas is the number of pods still to delete.
+	// +optional
+	RemainingReplicas int32 `json:"remainingReplicas,omitempty" protobuf:"varint,4,opt,name=remainingReplicas"`
+}
+
+// DeletionPolicyType defines what happens to the pods of a deleted PodSet.
+// +kubebuilder:validation:Enum=Orphan;Delete
+type DeletionPolicyType string
+
+const (
+	// OrphanDeletionPolicy releases the pods, and their claims, before the PodSet is
+	// removed so that they keep running and can be adopted by another PodSet.
+	OrphanDeletionPolicy DeletionPolicyType = "Orphan"
+
+	// DeletePodsDeletionPolicy lets the pods be garbage collected with the PodSet.
+	DeletePodsDeletionPolicy DeletionPolicyType = "Delete"
+)
+
+// ReshardPolicyType defines which pods are replaced when the replicas of a PodSet change.
+// +kubebuilder:validation:Enum=RestartAll;NewPodsOnly
+type ReshardPolicyType string
+
+const (
+	// RestartAllReshardPolicy rolls all the pods created for a different number of replicas.
+	RestartAllReshardPolicy ReshardPolicyType = "RestartAll"
+
+	// NewPodsOnlyReshardPolicy keeps the existing pods, only the new pods see the new replicas.
+	NewPodsOnlyReshardPolicy ReshardPolicyType = "NewPodsOnly"
+)
+
+// PodSetOverride patches the pod template of the pods selected by ordinal range or
+// by index. A pod is selected if it matches either of them.
+type PodSetOverride struct {
+	// Ordinals selects the pods whose ordinal is within the range.
+	// +optional
+	Ordinals *OrdinalRange `json:"ordinals,omitempty" protobuf:"bytes,1,opt,name=ordinals"`
+
+	// Indexes selects the pods with the given ordinals, a negative index counts from
+	// the end, -1 being the last pod of the PodSet.
+	// +optional
+	Indexes []int32 `json:"indexes,omitempty" protobuf:"varint,2,rep,name=indexes"`
+
+	// Patch is a strategic merge patch applied to the pod template of the selected pods.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Patch runtime.RawExtension `json:"patch" protobuf:"bytes,3,opt,name=patch"`
+}
+
+// OrdinalRange selects the ordinals from Start to End, both included.
+type OrdinalRange struct {
+	// Start is the first ordinal of the range.
+	Start int32 `json:"start" protobuf:"varint,1,opt,name=start"`
+
+	// End is the last ordinal of the range, defaults to the last pod of the PodSet.
+	// +optional
+	End *int32 `json:"end,omitempty" protobuf:"varint,2,opt,name=end"`
+}
+
+// PodIdentityType defines how the pods of a PodSet are named.
+// +kubebuilder:validation:Enum=Random;Ordinal
+type PodIdentityType string
+
+const (
+	// RandomPodIdentity names the pods after the PodSet with a random suffix.
+	RandomPodIdentity PodIdentityType = "Random"
+
+	// OrdinalPodIdentity names the pods <podset-name>-<ordinal>, from 0 to replicas-1.
+	// A deleted pod is replaced by a pod with the same name and the highest ordinals
+	// are removed first on scale down.
+	OrdinalPodIdentity PodIdentityType = "Ordinal"
+)
+
+// PodManagement describes how the pods of a PodSet are managed.
+type PodManagement struct {
+	// Identity of the pods, one of Random or Ordinal. It cannot be changed once set.
+	// Defaults to Random.
+	// +optional
+	Identity PodIdentityType `json:"identity,omitempty" protobuf:"bytes,1,opt,name=identity,casttype=PodIdentityType"`
+}
+
+// PodManagementPolicyType defines the policies for creating and deleting the pods of
+// an ordinal PodSet.
+// +kubebuilder:validation:Enum=OrderedReady;Parallel
+type PodManagementPolicyType string
+
+const (
+	// OrderedReadyPodManagement creates the pod of ordinal N only once the pod of
+	// ordinal N-1 is running and ready, and deletes the pods one at a time starting
+	// with the highest ordinal.
+	OrderedReadyPodManagement PodManagementPolicyType = "OrderedReady"
+
+	// ParallelPodManagement creates and deletes the pods all at once.
+	ParallelPodManagement PodManagementPolicyType = "Parallel"
+)
+
+// PersistentVolumeClaimRetentionPolicyType is a string enumeration of the policies
+// applied to the claims of a PodSet.
+// +kubebuilder:validation:Enum=Retain;Delete
+type PersistentVolumeClaimRetentionPolicyType string
+
+const (
+	// RetainPersistentVolumeClaimRetentionPolicyType keeps the claims, they are attached
+	// again if a pod with the same ordinal is created later.
+	RetainPersistentVolumeClaimRetentionPolicyType PersistentVolumeClaimRetentionPolicyType = "Retain"
+
+	// DeletePersistentVolumeClaimRetentionPolicyType deletes the claims once they are no
+	// longer used by a pod of the PodSet.
+	DeletePersistentVolumeClaimRetentionPolicyType PersistentVolumeClaimRetentionPolicyType = "Delete"
+)
+
+// PodSetPersistentVolumeClaimRetentionPolicy describes the lifecycle of the claims
+// created from the VolumeClaimTemplates of a PodSet.
+type PodSetPersistentVolumeClaimRetentionPolicy struct {
+	// WhenDeleted is applied to the claims when the PodSet is deleted, Delete makes
+	// the PodSet the owner of its claims so that they are garbage collected with it.
+	// Defaults to Retain.
+	// +optional
+	WhenDeleted PersistentVolumeClaimRetentionPolicyType `json:"whenDeleted,omitempty" protobuf:"bytes,1,opt,name=whenDeleted,casttype=PersistentVolumeClaimRetentionPolicyType"`
+
+	// WhenScaled is applied to the claims of the ordinals removed by a scale down of
+	// the PodSet, Delete removes them once their pods are gone. Suspending a PodSet is
+	// not a scale down. Defaults to Retain.
+	// +optional
+	WhenScaled PersistentVolumeClaimRetentionPolicyType `json:"whenScaled,omitempty" protobuf:"bytes,2,opt,name=whenScaled,casttype=PersistentVolumeClaimRetentionPolicyType"`
 }
 
 // PodSetStatus defines the observed state of PodSet
@@ -64,12 +497,107 @@ type PodSetStatus struct {
 	// +optional
 	UnavailableReplicas int32 `json:"unavailableReplicas,omitempty" protobuf:"varint,5,opt,name=unavailableReplicas"`
 
+	// WaitingOrdinal is the ordinal an OrderedReady PodSet waits on to be running and
+	// ready, or to be deleted, before going on with the next pod.
+	// +optional
+	WaitingOrdinal *int32 `json:"waitingOrdinal,omitempty" protobuf:"varint,8,opt,name=waitingOrdinal"`
+
+	// PendingReplacements is the number of pods replaced for being pending longer than
+	// the pending timeout.
+	// +optional
+	PendingReplacements int32 `json:"pendingReplacements,omitempty" protobuf:"varint,9,opt,name=pendingReplacements"`
+
+	// LastPendingReplacement describes the last pod replaced for being pending.
+	// +optional
+	LastPendingReplacement *PodSetPendingReplacement `json:"lastPendingReplacement,omitempty" protobuf:"bytes,10,opt,name=lastPendingReplacement"`
+
+	// The number of succeeded pods kept by this PodSet.
+	// +optional
+	SucceededReplicas int32 `json:"succeededReplicas,omitempty" protobuf:"varint,11,opt,name=succeededReplicas"`
+
+	// The number of failed pods kept by this PodSet.
+	// +optional
+	FailedReplicas int32 `json:"failedReplicas,omitempty" protobuf:"varint,12,opt,name=failedReplicas"`
+
+	// Domains are the pods of each domain of the topology of this PodSet.
+	// +optional
+	Domains []PodSetDomainStatus `json:"domains,omitempty" protobuf:"bytes,13,rep,name=domains"`
+
+	// Subsets are the pods of each subset of this PodSet.
+	// +optional
+	Subsets []PodSetSubsetStatus `json:"subsets,omitempty" protobuf:"bytes,14,rep,name=subsets"`
+
+	// UnplacedReplicas is the number of replicas no subset of this PodSet can take,
+	// all of them being at their maximum or unschedulable.
+	// +optional
+	UnplacedReplicas int32 `json:"unplacedReplicas,omitempty" protobuf:"varint,16,opt,name=unplacedReplicas"`
+
+	// Teardown reports the progress of the teardown of this PodSet once deleted.
+	// +optional
+	Teardown *PodSetTeardownStatus `json:"teardown,omitempty" protobuf:"bytes,15,opt,name=teardown"`
+
 	// Represents the latest available observations of a deployment's current state.
 	// +patchMergeKey=type
 	// +patchStrategy=merge
 	Conditions []PodSetCondition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,6,rep,name=conditions"`
 }
 
+// PodSetDomainStatus is the number of pods of a topology domain of a PodSet.
+type PodSetDomainStatus struct {
+	// Name is the name of the domain.
+	Name string `json:"name" protobuf:"bytes,1,opt,name=name"`
+
+	// Target is the number of pods the domain should have.
+	Target int32 `json:"target" protobuf:"varint,2,opt,name=target"`
+
+	// Replicas is the number of non-terminated pods of the domain.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty" protobuf:"varint,3,opt,name=replicas"`
+
+	// ReadyReplicas is the number of ready pods of the domain.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty" protobuf:"varint,4,opt,name=readyReplicas"`
+}
+
+// PodSetSubsetStatus is the number of pods of a subset of a PodSet.
+type PodSetSubsetStatus struct {
+	// Name is the name of the subset.
+	Name string `json:"name" protobuf:"bytes,1,opt,name=name"`
+
+	// Target is the number of pods the subset should have, after the pods of the
+	// subsets before it that spilled over.
+	Target int32 `json:"target" protobuf:"varint,2,opt,name=target"`
+
+	// Replicas is the number of non-terminated pods of the subset.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty" protobuf:"varint,3,opt,name=replicas"`
+
+	// ReadyReplicas is the number of ready pods of the subset.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty" protobuf:"varint,4,opt,name=readyReplicas"`
+
+	// Unschedulable is true if pods of the subset stay unschedulable, the subset then
+	// takes no more pods.
+	// +optional
+	Unschedulable bool `json:"unschedulable,omitempty" protobuf:"varint,5,opt,name=unschedulable"`
+}
+
+// PodSetPendingReplacement describes a pod replaced for being pending too long.
+type PodSetPendingReplacement struct {
+	// PodName is the name of the replaced pod.
+	PodName string `json:"podName" protobuf:"bytes,1,opt,name=podName"`
+
+	// Reason is why the pod was pending, Unschedulable or ContainerCreating.
+	Reason string `json:"reason" protobuf:"bytes,2,opt,name=reason"`
+
+	// Message is the message of the scheduler or of the kubelet about the pod.
+	// +optional
+	Message string `json:"message,omitempty" protobuf:"bytes,3,opt,name=message"`
+
+	// Time is when the pod was replaced.
+	Time metav1.Time `json:"time" protobuf:"bytes,4,opt,name=time"`
+}
+
 // PodSetCondition describes the state of a podset at a certain point.
 type PodSetCondition struct {
 	// Type of deployment condition.
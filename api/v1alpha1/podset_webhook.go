@@ -17,9 +17,15 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	validationutils "k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -27,6 +33,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
+// sampleRevision has the length of the longest pod template revision.
+const sampleRevision = "bcdfghjklm"
+
 // log is for logging in this package.
 var podsetlog = logf.Log.WithName("podset-resource")
 
@@ -65,6 +74,16 @@ func (r *PodSet) ValidateCreate() error {
 func (r *PodSet) ValidateUpdate(old runtime.Object) error {
 	podsetlog.Info("validate update", "name", r.Name)
 
+	oldPodSet, ok := old.(*PodSet)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a PodSet but got a %T", old))
+	}
+	if err := r.validatePodSetUpdate(oldPodSet); err != nil {
+		return apierrors.NewInvalid(
+			schema.GroupKind{Group: "pixiu.pixiu.io", Kind: "PodSet"},
+			r.Name, field.ErrorList{err})
+	}
+
 	return r.validatePodSet()
 }
 
@@ -80,9 +99,7 @@ func (r *PodSet) validatePodSet() error {
 	if err := r.validatePodSetName(); err != nil {
 		allErrs = append(allErrs, err)
 	}
-	if err := r.validatePodSetSpec(); err != nil {
-		allErrs = append(allErrs, err)
-	}
+	allErrs = append(allErrs, r.validatePodSetSpec()...)
 	if len(allErrs) == 0 {
 		return nil
 	}
@@ -92,11 +109,368 @@ func (r *PodSet) validatePodSet() error {
 		r.Name, allErrs)
 }
 
-func (r *PodSet) validatePodSetSpec() *field.Error {
-	// TODO
+func (r *PodSet) validatePodSetSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	if r.Spec.Burst != nil && *r.Spec.Burst < 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("burst"), *r.Spec.Burst, "must be greater than 0"))
+	}
+	if r.Spec.PendingTimeoutSeconds != nil && *r.Spec.PendingTimeoutSeconds < 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("pendingTimeoutSeconds"), *r.Spec.PendingTimeoutSeconds, "must be greater than 0"))
+	}
+	if r.Spec.ForceDeletion != nil && r.Spec.ForceDeletion.NodeNotReadySeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("forceDeletion", "nodeNotReadySeconds"), r.Spec.ForceDeletion.NodeNotReadySeconds, "must be greater than or equal to 0"))
+	}
+	if r.Spec.NodeFailurePolicy == SurgeNodeFailurePolicy && podIdentity(r) != RandomPodIdentity {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("nodeFailurePolicy"), "Surge is only supported by PodSets with a Random identity"))
+	}
+	if r.Spec.PodManagementPolicy == OrderedReadyPodManagement && podIdentity(r) != OrdinalPodIdentity {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("podManagementPolicy"), "OrderedReady is only supported by PodSets with an Ordinal identity"))
+	}
+	allErrs = append(allErrs, r.validateVolumeClaimTemplates(specPath.Child("volumeClaimTemplates"))...)
+	allErrs = append(allErrs, r.validateOverrides(specPath.Child("overrides"))...)
+	allErrs = append(allErrs, r.validatePodNameTemplate(specPath.Child("podNameTemplate"))...)
+	allErrs = append(allErrs, r.validateTeardown(specPath.Child("teardown"))...)
+	allErrs = append(allErrs, r.validateHealthPolicy(specPath.Child("healthPolicy"))...)
+	allErrs = append(allErrs, r.validateTopology(specPath.Child("topology"))...)
+	allErrs = append(allErrs, r.validateSubsets(specPath.Child("subsets"))...)
+	allErrs = append(allErrs, validateGang(&r.Spec, specPath.Child("gang"))...)
+	allErrs = append(allErrs, validateAntiAffinity(&r.Spec, specPath)...)
+	allErrs = append(allErrs, validateTerminatedPodRetention(&r.Spec, specPath.Child("terminatedPodRetention"))...)
+
+	return allErrs
+}
+
+func validateGang(spec *PodSetSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	gang := spec.Gang
+	if gang == nil {
+		return allErrs
+	}
+	if gang.TimeoutSeconds <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("timeoutSeconds"), gang.TimeoutSeconds, "must be greater than 0"))
+	}
+	if gang.MinMember != nil && (*gang.MinMember <= 0 || (spec.Replicas != nil && *gang.MinMember > *spec.Replicas)) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("minMember"), *gang.MinMember, "must be greater than 0 and less than or equal to replicas"))
+	}
+	if spec.PodManagementPolicy == OrderedReadyPodManagement {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "not supported by the OrderedReady pod management policy"))
+	}
+
+	return allErrs
+}
+
+// validateAntiAffinity validates the anti-affinity fields of the spec at fldPath.
+func validateAntiAffinity(spec *PodSetSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(spec.AntiAffinityTopologyKey) != 0 {
+		for _, msg := range validationutils.IsQualifiedName(spec.AntiAffinityTopologyKey) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("antiAffinityTopologyKey"), spec.AntiAffinityTopologyKey, msg))
+		}
+	}
+
+	return allErrs
+}
+
+func validateTerminatedPodRetention(spec *PodSetSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	retention := spec.TerminatedPodRetention
+	if retention == nil {
+		return allErrs
+	}
+	if retention.MaxCount != nil && *retention.MaxCount < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxCount"), *retention.MaxCount, "must be greater than or equal to 0"))
+	}
+	if retention.MaxAgeSeconds != nil && *retention.MaxAgeSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxAgeSeconds"), *retention.MaxAgeSeconds, "must be greater than or equal to 0"))
+	}
+
+	return allErrs
+}
+
+func (r *PodSet) validateVolumeClaimTemplates(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(r.Spec.VolumeClaimTemplates) == 0 {
+		return allErrs
+	}
+	if podIdentity(r) != OrdinalPodIdentity {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "only supported by PodSets with an Ordinal identity"))
+	}
+
+	names := make(map[string]bool)
+	for i, claim := range r.Spec.VolumeClaimTemplates {
+		namePath := fldPath.Index(i).Child("metadata", "name")
+		for _, msg := range validationutils.IsDNS1123Label(claim.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, claim.Name, msg))
+		}
+		if names[claim.Name] {
+			allErrs = append(allErrs, field.Duplicate(namePath, claim.Name))
+		}
+		names[claim.Name] = true
+	}
+
+	return allErrs
+}
+
+func (r *PodSet) validateOverrides(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(r.Spec.Overrides) == 0 {
+		return allErrs
+	}
+	if podIdentity(r) != OrdinalPodIdentity {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "only supported by PodSets with an Ordinal identity"))
+	}
+
+	template, err := json.Marshal(r.Spec.Template)
+	if err != nil {
+		return append(allErrs, field.InternalError(fldPath, err))
+	}
+	for i, override := range r.Spec.Overrides {
+		overridePath := fldPath.Index(i)
+		if override.Ordinals == nil && len(override.Indexes) == 0 {
+			allErrs = append(allErrs, field.Required(overridePath, "must select pods by ordinals or indexes"))
+		}
+		if ordinals := override.Ordinals; ordinals != nil {
+			if ordinals.Start < 0 {
+				allErrs = append(allErrs, field.Invalid(overridePath.Child("ordinals", "start"), ordinals.Start, "must be greater than or equal to 0"))
+			}
+			if ordinals.End != nil && *ordinals.End < ordinals.Start {
+				allErrs = append(allErrs, field.Invalid(overridePath.Child("ordinals", "end"), *ordinals.End, "must be greater than or equal to start"))
+			}
+		}
+		if _, err = strategicpatch.StrategicMergePatch(template, override.Patch.Raw, v1.PodTemplateSpec{}); err != nil {
+			allErrs = append(allErrs, field.Invalid(overridePath.Child("patch"), string(override.Patch.Raw), err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+// validatePodNameTemplate renders the pod name template with the highest index of the
+// PodSet and a sample revision, in every zone the pods may be pinned to, the pod names
+// must be valid DNS-1123 labels.
+func (r *PodSet) validatePodNameTemplate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	nameTemplate := r.Spec.PodNameTemplate
+	if len(nameTemplate) == 0 {
+		return allErrs
+	}
+
+	zones := r.getPodZones()
+	fields := PodNameFields{
+		Name:     r.Name,
+		Zone:     zones[0],
+		Revision: sampleRevision,
+	}
+	if r.Spec.Replicas != nil && *r.Spec.Replicas > 1 {
+		fields.Index = int(*r.Spec.Replicas) - 1
+	}
+	dependsOnIndex, err := PodNameDependsOnIndex(nameTemplate, fields)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath, nameTemplate, err.Error()))
+	}
+	if podIdentity(r) == OrdinalPodIdentity && !dependsOnIndex {
+		allErrs = append(allErrs, field.Invalid(fldPath, nameTemplate, "must refer to {{.Index}} to name the pods of an Ordinal PodSet"))
+	}
+
+	for _, zone := range zones {
+		fields.Zone = zone
+		name, err := RenderPodName(nameTemplate, fields)
+		if err != nil {
+			return append(allErrs, field.Invalid(fldPath, nameTemplate, err.Error()))
+		}
+		if podIdentity(r) != OrdinalPodIdentity {
+			// The pods get a dash and a random suffix of 5 characters appended.
+			name += "-" + sampleRevision[:5]
+		}
+		for _, msg := range validationutils.IsDNS1123Label(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath, nameTemplate, fmt.Sprintf("renders %q: %s", name, msg)))
+		}
+	}
+
+	return allErrs
+}
+
+// getPodZones returns the zones the pods of the PodSet may be pinned to. The pods are
+// pinned to the domains of the topology on top of the affinity of the template, so
+// that every domain is a zone when the domains are zones, unless the node selector of
+// the template pins the zone already.
+func (r *PodSet) getPodZones() []string {
+	zone := GetPodZone(&r.Spec.Template)
+	topology := r.Spec.Topology
+	if topology == nil || len(topology.Domains) == 0 {
+		return []string{zone}
+	}
+	if len(topology.TopologyKey) != 0 && topology.TopologyKey != v1.LabelTopologyZone {
+		return []string{zone}
+	}
+	if _, ok := r.Spec.Template.Spec.NodeSelector[v1.LabelTopologyZone]; ok {
+		return []string{zone}
+	}
+
+	zones := make([]string, 0, len(topology.Domains))
+	for _, domain := range topology.Domains {
+		zones = append(zones, domain.Name)
+	}
+	return zones
+}
+
+func (r *PodSet) validateTeardown(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	teardown := r.Spec.Teardown
+	if teardown == nil {
+		return allErrs
+	}
+	if r.Spec.DeletionPolicy == OrphanDeletionPolicy {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "not supported by the Orphan deletion policy"))
+	}
+	if teardown.MaxUnavailable != nil {
+		maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(teardown.MaxUnavailable, 100, false)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("maxUnavailable"), teardown.MaxUnavailable.String(), err.Error()))
+		} else if maxUnavailable < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("maxUnavailable"), teardown.MaxUnavailable.String(), "must be greater than or equal to 0"))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *PodSet) validateHealthPolicy(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	policy := r.Spec.HealthPolicy
+	if policy == nil {
+		return allErrs
+	}
+	if policy.MaxNotReadySeconds <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxNotReadySeconds"), policy.MaxNotReadySeconds, "must be greater than 0"))
+	}
+	if policy.MaxConcurrentHeals != nil {
+		maxConcurrentHeals, err := intstr.GetScaledValueFromIntOrPercent(policy.MaxConcurrentHeals, 100, false)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("maxConcurrentHeals"), policy.MaxConcurrentHeals.String(), err.Error()))
+		} else if maxConcurrentHeals < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("maxConcurrentHeals"), policy.MaxConcurrentHeals.String(), "must be greater than or equal to 0"))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *PodSet) validateTopology(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	topology := r.Spec.Topology
+	if topology == nil {
+		return allErrs
+	}
+	if len(topology.TopologyKey) != 0 {
+		for _, msg := range validationutils.IsQualifiedName(topology.TopologyKey) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topologyKey"), topology.TopologyKey, msg))
+		}
+	}
+	if len(topology.Domains) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("domains"), "at least one domain is required"))
+		return allErrs
+	}
+
+	names := make(map[string]bool, len(topology.Domains))
+	var totalWeight int64
+	for i, domain := range topology.Domains {
+		domainPath := fldPath.Child("domains").Index(i)
+		if len(domain.Name) == 0 {
+			allErrs = append(allErrs, field.Required(domainPath.Child("name"), ""))
+		}
+		for _, msg := range validationutils.IsValidLabelValue(domain.Name) {
+			allErrs = append(allErrs, field.Invalid(domainPath.Child("name"), domain.Name, msg))
+		}
+		if names[domain.Name] {
+			allErrs = append(allErrs, field.Duplicate(domainPath.Child("name"), domain.Name))
+		}
+		names[domain.Name] = true
+
+		weight := int32(1)
+		if domain.Weight != nil {
+			weight = *domain.Weight
+		}
+		if weight < 0 {
+			allErrs = append(allErrs, field.Invalid(domainPath.Child("weight"), weight, "must be greater than or equal to 0"))
+		}
+		totalWeight += int64(weight)
+	}
+	if totalWeight <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("domains"), totalWeight, "the weights of the domains must not all be 0"))
+	}
+
+	return allErrs
+}
+
+func (r *PodSet) validateSubsets(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(r.Spec.Subsets) == 0 {
+		return allErrs
+	}
+	if podIdentity(r) != RandomPodIdentity {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "only supported by PodSets with a Random identity"))
+	}
+	if r.Spec.Topology != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "cannot be combined with a topology"))
+	}
+
+	template, err := json.Marshal(r.Spec.Template)
+	if err != nil {
+		return append(allErrs, field.InternalError(fldPath, err))
+	}
+	names := make(map[string]bool, len(r.Spec.Subsets))
+	for i, subset := range r.Spec.Subsets {
+		subsetPath := fldPath.Index(i)
+		if len(subset.Name) == 0 {
+			allErrs = append(allErrs, field.Required(subsetPath.Child("name"), ""))
+		}
+		for _, msg := range validationutils.IsValidLabelValue(subset.Name) {
+			allErrs = append(allErrs, field.Invalid(subsetPath.Child("name"), subset.Name, msg))
+		}
+		if names[subset.Name] {
+			allErrs = append(allErrs, field.Duplicate(subsetPath.Child("name"), subset.Name))
+		}
+		names[subset.Name] = true
+
+		if subset.Replicas != nil {
+			replicas, err := intstr.GetScaledValueFromIntOrPercent(subset.Replicas, 100, false)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(subsetPath.Child("replicas"), subset.Replicas.String(), err.Error()))
+			} else if replicas < 0 {
+				allErrs = append(allErrs, field.Invalid(subsetPath.Child("replicas"), subset.Replicas.String(), "must be greater than or equal to 0"))
+			}
+		}
+		if subset.MaxReplicas != nil && *subset.MaxReplicas < 0 {
+			allErrs = append(allErrs, field.Invalid(subsetPath.Child("maxReplicas"), *subset.MaxReplicas, "must be greater than or equal to 0"))
+		}
+		if len(subset.Patch.Raw) != 0 {
+			if _, err = strategicpatch.StrategicMergePatch(template, subset.Patch.Raw, v1.PodTemplateSpec{}); err != nil {
+				allErrs = append(allErrs, field.Invalid(subsetPath.Child("patch"), string(subset.Patch.Raw), err.Error()))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func (r *PodSet) validatePodSetUpdate(old *PodSet) *field.Error {
+	if podIdentity(r) != podIdentity(old) {
+		return field.Forbidden(field.NewPath("spec", "podManagement", "identity"), "field is immutable")
+	}
+
 	return nil
 }
 
+// podIdentity returns the pod identity of the PodSet, which defaults to Random.
+func podIdentity(ps *PodSet) PodIdentityType {
+	if len(ps.Spec.PodManagement.Identity) == 0 {
+		return RandomPodIdentity
+	}
+	return ps.Spec.PodManagement.Identity
+}
+
 func (r *PodSet) validatePodSetName() *field.Error {
 	if len(r.ObjectMeta.Name) == 0 {
 		return field.Invalid(field.NewPath("metadata").Child("name"), r.Name, "must be than 0 characters")
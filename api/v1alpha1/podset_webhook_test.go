@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidatePodNameTemplate(t *testing.T) {
+	zones := &PodSetTopology{Domains: []PodSetTopologyDomain{{Name: "zone-a"}, {Name: "Zone_B"}}}
+	racks := &PodSetTopology{TopologyKey: "example.com/rack", Domains: []PodSetTopologyDomain{{Name: "Rack_1"}}}
+	tests := []struct {
+		name         string
+		identity     PodIdentityType
+		nameTemplate string
+		topology     *PodSetTopology
+		nodeSelector map[string]string
+		invalid      []string
+	}{
+		{name: "no template", identity: OrdinalPodIdentity},
+		{name: "index", identity: OrdinalPodIdentity, nameTemplate: "{{.Name}}-{{.Index}}"},
+		{name: "ordinal without index", identity: OrdinalPodIdentity, nameTemplate: "{{.Name}}", invalid: []string{"{{.Index}}"}},
+		{name: "too long", identity: RandomPodIdentity, nameTemplate: "{{.Name}}-{{.Index}}-abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz", invalid: []string{"no more than 63 characters"}},
+		{name: "valid zones", identity: OrdinalPodIdentity, nameTemplate: "{{.Name}}-{{.Zone}}-{{.Index}}", topology: &PodSetTopology{Domains: zones.Domains[:1]}},
+		{name: "invalid zone", identity: OrdinalPodIdentity, nameTemplate: "{{.Name}}-{{.Zone}}-{{.Index}}", topology: zones, invalid: []string{"web-Zone_B-2"}},
+		{name: "random pods in an invalid zone", identity: RandomPodIdentity, nameTemplate: "{{.Name}}-{{.Zone}}", topology: zones, invalid: []string{"web-Zone_B-"}},
+		{name: "domains not zones", identity: OrdinalPodIdentity, nameTemplate: "{{.Name}}-{{.Zone}}-{{.Index}}", topology: racks},
+		{
+			name:         "zone pinned by the node selector",
+			identity:     OrdinalPodIdentity,
+			nameTemplate: "{{.Name}}-{{.Zone}}-{{.Index}}",
+			topology:     zones,
+			nodeSelector: map[string]string{v1.LabelTopologyZone: "zone-a"},
+		},
+	}
+
+	for _, test := range tests {
+		replicas := int32(3)
+		ps := &PodSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec: PodSetSpec{
+				Replicas:        &replicas,
+				PodManagement:   PodManagement{Identity: test.identity},
+				PodNameTemplate: test.nameTemplate,
+				Topology:        test.topology,
+				Template:        v1.PodTemplateSpec{Spec: v1.PodSpec{NodeSelector: test.nodeSelector}},
+			},
+		}
+		errs := ps.validatePodNameTemplate(field.NewPath("spec", "podNameTemplate"))
+		if len(errs) != len(test.invalid) {
+			t.Errorf("%s: expected %d errors, got %v", test.name, len(test.invalid), errs)
+			continue
+		}
+		for i, err := range errs {
+			if !strings.Contains(err.Error(), test.invalid[i]) {
+				t.Errorf("%s: expected an error about %q, got %v", test.name, test.invalid[i], err)
+			}
+		}
+	}
+}
@@ -22,10 +22,48 @@ limitations under the License.
 package v1alpha1
 
 import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrdinalRange) DeepCopyInto(out *OrdinalRange) {
+	*out = *in
+	if in.End != nil {
+		in, out := &in.End, &out.End
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrdinalRange.
+func (in *OrdinalRange) DeepCopy() *OrdinalRange {
+	if in == nil {
+		return nil
+	}
+	out := new(OrdinalRange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodManagement) DeepCopyInto(out *PodManagement) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodManagement.
+func (in *PodManagement) DeepCopy() *PodManagement {
+	if in == nil {
+		return nil
+	}
+	out := new(PodManagement)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodSet) DeepCopyInto(out *PodSet) {
 	*out = *in
@@ -70,6 +108,76 @@ func (in *PodSetCondition) DeepCopy() *PodSetCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetDomainStatus) DeepCopyInto(out *PodSetDomainStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetDomainStatus.
+func (in *PodSetDomainStatus) DeepCopy() *PodSetDomainStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetDomainStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetForceDeletion) DeepCopyInto(out *PodSetForceDeletion) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetForceDeletion.
+func (in *PodSetForceDeletion) DeepCopy() *PodSetForceDeletion {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetForceDeletion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetGang) DeepCopyInto(out *PodSetGang) {
+	*out = *in
+	if in.MinMember != nil {
+		in, out := &in.MinMember, &out.MinMember
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetGang.
+func (in *PodSetGang) DeepCopy() *PodSetGang {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetGang)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetHealthPolicy) DeepCopyInto(out *PodSetHealthPolicy) {
+	*out = *in
+	if in.MaxConcurrentHeals != nil {
+		in, out := &in.MaxConcurrentHeals, &out.MaxConcurrentHeals
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetHealthPolicy.
+func (in *PodSetHealthPolicy) DeepCopy() *PodSetHealthPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetHealthPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodSetList) DeepCopyInto(out *PodSetList) {
 	*out = *in
@@ -102,6 +210,63 @@ func (in *PodSetList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetOverride) DeepCopyInto(out *PodSetOverride) {
+	*out = *in
+	if in.Ordinals != nil {
+		in, out := &in.Ordinals, &out.Ordinals
+		*out = new(OrdinalRange)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Indexes != nil {
+		in, out := &in.Indexes, &out.Indexes
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	in.Patch.DeepCopyInto(&out.Patch)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetOverride.
+func (in *PodSetOverride) DeepCopy() *PodSetOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetPendingReplacement) DeepCopyInto(out *PodSetPendingReplacement) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetPendingReplacement.
+func (in *PodSetPendingReplacement) DeepCopy() *PodSetPendingReplacement {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetPendingReplacement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetPersistentVolumeClaimRetentionPolicy) DeepCopyInto(out *PodSetPersistentVolumeClaimRetentionPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetPersistentVolumeClaimRetentionPolicy.
+func (in *PodSetPersistentVolumeClaimRetentionPolicy) DeepCopy() *PodSetPersistentVolumeClaimRetentionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetPersistentVolumeClaimRetentionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodSetSpec) DeepCopyInto(out *PodSetSpec) {
 	*out = *in
@@ -116,6 +281,78 @@ func (in *PodSetSpec) DeepCopyInto(out *PodSetSpec) {
 		(*in).DeepCopyInto(*out)
 	}
 	in.Template.DeepCopyInto(&out.Template)
+	if in.Suspend != nil {
+		in, out := &in.Suspend, &out.Suspend
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Burst != nil {
+		in, out := &in.Burst, &out.Burst
+		*out = new(int32)
+		**out = **in
+	}
+	out.PodManagement = in.PodManagement
+	if in.VolumeClaimTemplates != nil {
+		in, out := &in.VolumeClaimTemplates, &out.VolumeClaimTemplates
+		*out = make([]corev1.PersistentVolumeClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PersistentVolumeClaimRetentionPolicy != nil {
+		in, out := &in.PersistentVolumeClaimRetentionPolicy, &out.PersistentVolumeClaimRetentionPolicy
+		*out = new(PodSetPersistentVolumeClaimRetentionPolicy)
+		**out = **in
+	}
+	if in.Overrides != nil {
+		in, out := &in.Overrides, &out.Overrides
+		*out = make([]PodSetOverride, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Teardown != nil {
+		in, out := &in.Teardown, &out.Teardown
+		*out = new(PodSetTeardown)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PendingTimeoutSeconds != nil {
+		in, out := &in.PendingTimeoutSeconds, &out.PendingTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ForceDeletion != nil {
+		in, out := &in.ForceDeletion, &out.ForceDeletion
+		*out = new(PodSetForceDeletion)
+		**out = **in
+	}
+	if in.HealthPolicy != nil {
+		in, out := &in.HealthPolicy, &out.HealthPolicy
+		*out = new(PodSetHealthPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TerminatedPodRetention != nil {
+		in, out := &in.TerminatedPodRetention, &out.TerminatedPodRetention
+		*out = new(PodSetTerminatedPodRetention)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Topology != nil {
+		in, out := &in.Topology, &out.Topology
+		*out = new(PodSetTopology)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Subsets != nil {
+		in, out := &in.Subsets, &out.Subsets
+		*out = make([]PodSetSubset, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Gang != nil {
+		in, out := &in.Gang, &out.Gang
+		*out = new(PodSetGang)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetSpec.
@@ -131,6 +368,31 @@ func (in *PodSetSpec) DeepCopy() *PodSetSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodSetStatus) DeepCopyInto(out *PodSetStatus) {
 	*out = *in
+	if in.WaitingOrdinal != nil {
+		in, out := &in.WaitingOrdinal, &out.WaitingOrdinal
+		*out = new(int32)
+		**out = **in
+	}
+	if in.LastPendingReplacement != nil {
+		in, out := &in.LastPendingReplacement, &out.LastPendingReplacement
+		*out = new(PodSetPendingReplacement)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Domains != nil {
+		in, out := &in.Domains, &out.Domains
+		*out = make([]PodSetDomainStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Subsets != nil {
+		in, out := &in.Subsets, &out.Subsets
+		*out = make([]PodSetSubsetStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Teardown != nil {
+		in, out := &in.Teardown, &out.Teardown
+		*out = new(PodSetTeardownStatus)
+		**out = **in
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]PodSetCondition, len(*in))
@@ -149,3 +411,151 @@ func (in *PodSetStatus) DeepCopy() *PodSetStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetSubset) DeepCopyInto(out *PodSetSubset) {
+	*out = *in
+	in.Patch.DeepCopyInto(&out.Patch)
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetSubset.
+func (in *PodSetSubset) DeepCopy() *PodSetSubset {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetSubset)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetSubsetStatus) DeepCopyInto(out *PodSetSubsetStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetSubsetStatus.
+func (in *PodSetSubsetStatus) DeepCopy() *PodSetSubsetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetSubsetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetTeardown) DeepCopyInto(out *PodSetTeardown) {
+	*out = *in
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.PreDeleteHook != nil {
+		in, out := &in.PreDeleteHook, &out.PreDeleteHook
+		*out = new(batchv1.JobTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetTeardown.
+func (in *PodSetTeardown) DeepCopy() *PodSetTeardown {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetTeardown)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetTeardownStatus) DeepCopyInto(out *PodSetTeardownStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetTeardownStatus.
+func (in *PodSetTeardownStatus) DeepCopy() *PodSetTeardownStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetTeardownStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetTerminatedPodRetention) DeepCopyInto(out *PodSetTerminatedPodRetention) {
+	*out = *in
+	if in.MaxCount != nil {
+		in, out := &in.MaxCount, &out.MaxCount
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxAgeSeconds != nil {
+		in, out := &in.MaxAgeSeconds, &out.MaxAgeSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetTerminatedPodRetention.
+func (in *PodSetTerminatedPodRetention) DeepCopy() *PodSetTerminatedPodRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetTerminatedPodRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetTopology) DeepCopyInto(out *PodSetTopology) {
+	*out = *in
+	if in.Domains != nil {
+		in, out := &in.Domains, &out.Domains
+		*out = make([]PodSetTopologyDomain, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetTopology.
+func (in *PodSetTopology) DeepCopy() *PodSetTopology {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetTopology)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetTopologyDomain) DeepCopyInto(out *PodSetTopologyDomain) {
+	*out = *in
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetTopologyDomain.
+func (in *PodSetTopologyDomain) DeepCopy() *PodSetTopologyDomain {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetTopologyDomain)
+	in.DeepCopyInto(out)
+	return out
+}
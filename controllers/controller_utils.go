@@ -18,6 +18,7 @@ package controllers
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -28,9 +29,24 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 
 	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
 )
 
-func GetPodFromTemplate(template *corev1.PodTemplateSpec, parentObject runtime.Object, controllerRef *metav1.OwnerReference) (*corev1.Pod, error) {
+// GetPodFromTemplate builds a pod from the template of its parent. The ordinal is the
+// index of the pod within its parent, or -1 for pods without index. The pods of a
+// PodSet are built from their own template, with the overrides of their ordinal and
+// their subset applied and pinned to their topology domain if any, labeled with its
+// revision and told their index through the environment.
+func GetPodFromTemplate(template *corev1.PodTemplateSpec, parentObject runtime.Object, controllerRef *metav1.OwnerReference, ordinal int, placement podPlacement) (*corev1.Pod, error) {
+	ps, isPodSet := parentObject.(*pixiuv1alpha1.PodSet)
+	if isPodSet {
+		podTemplate, err := getPodTemplate(ps, ordinal, placement)
+		if err != nil {
+			return nil, err
+		}
+		template = podTemplate
+	}
+
 	desiredLabels := getPodsLabelSet(template)
 	desiredFinalizers := getPodsFinalizers(template)
 	desiredAnnotations := getPodsAnnotationSet(template)
@@ -47,11 +63,40 @@ func GetPodFromTemplate(template *corev1.PodTemplateSpec, parentObject runtime.O
 			GenerateName: prefix,
 			Finalizers:   desiredFinalizers,
 		},
+		// The spec is copied first, the storage and the environment of the PodSet
+		// are added to it.
+		Spec: *template.Spec.DeepCopy(),
+	}
+	if ordinal >= 0 {
+		pod.Labels[pixiutypes.PodSetOrdinalLabel] = strconv.Itoa(ordinal)
+	}
+	if len(placement.domain) != 0 {
+		pod.Labels[pixiutypes.PodSetTopologyDomainLabel] = placement.domain
+	}
+	if len(placement.subset) != 0 {
+		pod.Labels[pixiutypes.PodSetSubsetLabel] = placement.subset
+	}
+	if isPodSet {
+		revision := computeRevision(template)
+		if err = setPodName(ps, pod, template, revision, ordinal); err != nil {
+			return nil, err
+		}
+		if ordinal >= 0 && isOrdinal(ps) {
+			updateStorage(ps, pod, ordinal)
+		}
+		pod.Labels[pixiutypes.PodSetNameLabel] = ps.Name
+		pod.Labels[pixiutypes.PodSetRevisionLabel] = revision
+		pod.Labels[pixiutypes.PodSetPatchRevisionLabel] = getPatchRevision(ps, ordinal, placement.subset)
+		if ps.Spec.Gang != nil {
+			// Out of the revision, so that enabling gang scheduling does not roll the pods.
+			pod.Labels[pixiutypes.PodGroupLabel] = ps.Name
+		}
+		pod.Annotations[pixiutypes.PodSetReplicasAnnotation] = strconv.Itoa(int(*ps.Spec.Replicas))
+		injectPodSetEnv(pod)
 	}
 	if controllerRef != nil {
 		pod.OwnerReferences = append(pod.OwnerReferences, *controllerRef)
 	}
-	pod.Spec = *template.Spec.DeepCopy()
 	return pod, nil
 }
 
@@ -88,6 +133,55 @@ func getPodsPrefix(controllerName string) string {
 	return prefix
 }
 
+// setPodName names the pod of the given index after the pod name template of the
+// PodSet. Pods with a stable identity get the rendered name, the others get a random
+// suffix appended to it. Without template, pods with a stable identity are named
+// after their ordinal.
+func setPodName(ps *pixiuv1alpha1.PodSet, pod *corev1.Pod, template *corev1.PodTemplateSpec, revision string, ordinal int) error {
+	stable := ordinal >= 0 && isOrdinal(ps)
+	if len(ps.Spec.PodNameTemplate) == 0 {
+		if stable {
+			pod.GenerateName = ""
+			pod.Name = getOrdinalPodName(ps.Name, ordinal)
+		}
+		return nil
+	}
+
+	name, err := pixiuv1alpha1.RenderPodName(ps.Spec.PodNameTemplate, pixiuv1alpha1.PodNameFields{
+		Name:     ps.Name,
+		Index:    ordinal,
+		Zone:     pixiuv1alpha1.GetPodZone(template),
+		Revision: revision,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render the pod name template: %v", err)
+	}
+	if stable {
+		pod.GenerateName = ""
+		pod.Name = name
+	} else {
+		pod.GenerateName = getPodsPrefix(name)
+	}
+	return nil
+}
+
+func getOrdinalPodName(controllerName string, ordinal int) string {
+	return fmt.Sprintf("%s-%d", controllerName, ordinal)
+}
+
+// getPodOrdinal returns the ordinal recorded on the pod, false if the pod has no valid ordinal.
+func getPodOrdinal(pod *corev1.Pod) (int, bool) {
+	value, ok := pod.Labels[pixiutypes.PodSetOrdinalLabel]
+	if !ok {
+		return -1, false
+	}
+	ordinal, err := strconv.Atoi(value)
+	if err != nil || ordinal < 0 {
+		return -1, false
+	}
+	return ordinal, true
+}
+
 func validateControllerRef(controllerRef *metav1.OwnerReference) error {
 	if controllerRef == nil {
 		return fmt.Errorf("controllerRef is nil")
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	"github.com/caoyingjunz/podset-operator/pkg/ratelimit"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// newTestReconciler returns a reconciler backed by a fake client holding the given
+// objects, without rate limits.
+func newTestReconciler(objs ...client.Object) *PodSetReconciler {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = pixiuv1alpha1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	return &PodSetReconciler{
+		Client:    c,
+		APIReader: c,
+		Scheme:    scheme,
+		Log:       logr.Discard(),
+		Recorder:  record.NewFakeRecorder(100),
+		Governor:  ratelimit.NewGovernor(ratelimit.Options{}),
+	}
+}
+
+func newTestPodSet(name string, replicas int32, identity pixiuv1alpha1.PodIdentityType) *pixiuv1alpha1.PodSet {
+	return &pixiuv1alpha1.PodSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: pixiuv1alpha1.PodSetSpec{
+			Replicas:      &replicas,
+			PodManagement: pixiuv1alpha1.PodManagement{Identity: identity},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "nginx"}},
+				},
+			},
+		},
+	}
+}
+
+func TestGetPodFromTemplateStorage(t *testing.T) {
+	ps := newTestPodSet("web", 2, pixiuv1alpha1.OrdinalPodIdentity)
+	ps.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "data"}}}
+	ps.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: "/data"}}
+
+	pod, err := GetPodFromTemplate(&ps.Spec.Template, ps, nil, 1, podPlacement{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Name != "web-1" {
+		t.Errorf("expected pod web-1, got %s", pod.Name)
+	}
+	if len(pod.Spec.Volumes) != 1 {
+		t.Fatalf("expected 1 volume, got %v", pod.Spec.Volumes)
+	}
+	volume := pod.Spec.Volumes[0]
+	if volume.Name != "data" || volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != "data-web-1" {
+		t.Errorf("expected volume data of claim data-web-1, got %+v", volume)
+	}
+	mounts := pod.Spec.Containers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].Name != "data" || mounts[0].MountPath != "/data" {
+		t.Errorf("expected the data volume mounted on /data, got %v", mounts)
+	}
+	if len(ps.Spec.Template.Spec.Volumes) != 0 {
+		t.Errorf("expected the template of the PodSet untouched, got volumes %v", ps.Spec.Template.Spec.Volumes)
+	}
+}
+
+func TestGetPodFromTemplateEnv(t *testing.T) {
+	ps := newTestPodSet("shard", 3, pixiuv1alpha1.RandomPodIdentity)
+	ps.Spec.Template.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	ps.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{{Name: pixiutypes.PodSetNameEnv, Value: "custom"}}
+
+	pod, err := GetPodFromTemplate(&ps.Spec.Template, ps, nil, 2, podPlacement{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Labels[pixiutypes.PodSetOrdinalLabel] != "2" {
+		t.Errorf("expected index label 2, got %q", pod.Labels[pixiutypes.PodSetOrdinalLabel])
+	}
+	if pod.Annotations[pixiutypes.PodSetReplicasAnnotation] != "3" {
+		t.Errorf("expected replicas annotation 3, got %q", pod.Annotations[pixiutypes.PodSetReplicasAnnotation])
+	}
+
+	tests := []struct {
+		container corev1.Container
+		name      string
+		fieldPath string
+		value     string
+	}{
+		{pod.Spec.InitContainers[0], pixiutypes.PodSetIndexEnv, "metadata.labels['" + pixiutypes.PodSetOrdinalLabel + "']", ""},
+		{pod.Spec.Containers[0], pixiutypes.PodSetIndexEnv, "metadata.labels['" + pixiutypes.PodSetOrdinalLabel + "']", ""},
+		{pod.Spec.Containers[0], pixiutypes.PodSetReplicasEnv, "metadata.annotations['" + pixiutypes.PodSetReplicasAnnotation + "']", ""},
+		{pod.Spec.InitContainers[0], pixiutypes.PodSetNameEnv, "metadata.labels['" + pixiutypes.PodSetNameLabel + "']", ""},
+		// The variables defined by the container are left untouched.
+		{pod.Spec.Containers[0], pixiutypes.PodSetNameEnv, "", "custom"},
+	}
+	for _, test := range tests {
+		var found []corev1.EnvVar
+		for _, env := range test.container.Env {
+			if env.Name == test.name {
+				found = append(found, env)
+			}
+		}
+		if len(found) != 1 {
+			t.Errorf("container %s: expected one %s variable, got %v", test.container.Name, test.name, found)
+			continue
+		}
+		fieldPath := ""
+		if found[0].ValueFrom != nil && found[0].ValueFrom.FieldRef != nil {
+			fieldPath = found[0].ValueFrom.FieldRef.FieldPath
+		}
+		if fieldPath != test.fieldPath || found[0].Value != test.value {
+			t.Errorf("container %s: expected %s from %q with value %q, got %+v", test.container.Name, test.name, test.fieldPath, test.value, found[0])
+		}
+	}
+	if len(ps.Spec.Template.Spec.Containers[0].Env) != 1 {
+		t.Errorf("expected the template of the PodSet untouched, got env %v", ps.Spec.Template.Spec.Containers[0].Env)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+const (
+	// crashLoopWindow is how long a failure counts towards a crash loop.
+	crashLoopWindow = 10 * time.Minute
+	// crashLoopRestarts is the number of restarts of a container deemed crash looping
+	// when it failed recently.
+	crashLoopRestarts = 3
+	// crashLoopFailedPods is the number of pods of a PodSet which failed recently for
+	// the PodSet to be deemed crash looping.
+	crashLoopFailedPods = 3
+
+	// DefaultCrashLoopBackoff and MaxCrashLoopBackoff bound the exponential backoff of
+	// the replacement of crash looping pods.
+	DefaultCrashLoopBackoff = 10 * time.Second
+	MaxCrashLoopBackoff     = 5 * time.Minute
+)
+
+// notCrashingReasons are the reasons of the pods failed by their node rather than by
+// their containers, which do not count towards a crash loop.
+var notCrashingReasons = sets.NewString("Evicted", "Preempting", "Shutdown")
+
+// getCrashLoop returns why the PodSet is crash looping, empty if it is not. A PodSet
+// is crash looping if one of its containers is in CrashLoopBackOff or restarted many
+// times and failed recently, or if many of its pods failed recently.
+func getCrashLoop(pods []corev1.Pod, now time.Time) string {
+	failed := 0
+	var last *corev1.Pod
+	var lastMessage string
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if message, ok := getContainerCrashLoop(pod, now); ok {
+			return fmt.Sprintf("pod %s is crash looping: %s", pod.Name, message)
+		}
+		if message, ok := getRecentFailure(pod, now); ok {
+			failed++
+			// The last pod to fail is described.
+			if last == nil || getTerminationTime(pod).After(getTerminationTime(last)) {
+				last, lastMessage = pod, message
+			}
+		}
+	}
+	if failed < crashLoopFailedPods {
+		return ""
+	}
+	return fmt.Sprintf("%d pods failed in the last %v, pod %s: %s", failed, crashLoopWindow, last.Name, lastMessage)
+}
+
+// getRecentFailure returns how the pod failed if it failed recently, the pods failed
+// by their node do not count.
+func getRecentFailure(pod *corev1.Pod, now time.Time) (string, bool) {
+	if pod.Status.Phase != corev1.PodFailed || notCrashingReasons.Has(pod.Status.Reason) {
+		return "", false
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 && isRecent(terminated.FinishedAt.Time, now) {
+			return getTerminationMessage(status.Name, terminated), true
+		}
+	}
+	if len(statuses) == 0 && pod.Status.StartTime != nil && isRecent(pod.Status.StartTime.Time, now) {
+		return fmt.Sprintf("%s: %s", pod.Status.Reason, pod.Status.Message), true
+	}
+	return "", false
+}
+
+// getContainerCrashLoop returns why a container of the pod is crash looping, if one
+// is in CrashLoopBackOff or restarted many times and failed recently.
+func getContainerCrashLoop(pod *corev1.Pod, now time.Time) (string, bool) {
+	if IsPodTerminated(pod) {
+		return "", false
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		last := status.LastTerminationState.Terminated
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason == "CrashLoopBackOff" {
+			if last != nil {
+				return getTerminationMessage(status.Name, last), true
+			}
+			return fmt.Sprintf("container %s: %s", status.Name, waiting.Message), true
+		}
+		if status.RestartCount >= crashLoopRestarts && last != nil && isRecent(last.FinishedAt.Time, now) {
+			return getTerminationMessage(status.Name, last), true
+		}
+	}
+	return "", false
+}
+
+// getTerminationMessage describes the termination of the container, with the message
+// it left if any.
+func getTerminationMessage(container string, terminated *corev1.ContainerStateTerminated) string {
+	message := fmt.Sprintf("container %s exited with code %d", container, terminated.ExitCode)
+	if len(terminated.Reason) != 0 {
+		message = fmt.Sprintf("%s (%s)", message, terminated.Reason)
+	}
+	if len(terminated.Message) != 0 {
+		message = fmt.Sprintf("%s: %s", message, terminated.Message)
+	}
+	return message
+}
+
+func isRecent(t time.Time, now time.Time) bool {
+	return now.Sub(t) < crashLoopWindow
+}
+
+func getPodSetKey(podSet *pixiuv1alpha1.PodSet) string {
+	return types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}.String()
+}
+
+// holdCreations returns true if the creation of pods has to wait for the backoff of
+// the crash looping PodSet. Otherwise the creations go on and the next ones are
+// backed off exponentially while the PodSet keeps crash looping.
+func (r *PodSetReconciler) holdCreations(podSet *pixiuv1alpha1.PodSet, crashLoop string) bool {
+	if len(crashLoop) == 0 {
+		return false
+	}
+	key := getPodSetKey(podSet)
+	now := r.Backoff.Clock.Now()
+	if r.Backoff.IsInBackOffSinceUpdate(key, now) {
+		return true
+	}
+
+	r.Backoff.Next(key, now)
+	r.Recorder.Eventf(podSet, corev1.EventTypeWarning, pixiutypes.CrashLoopingReason, "Backing off the next pod replacements for %v, %s", r.Backoff.Get(key), crashLoop)
+	return false
+}
+
+// getCreationBackoff returns how long the crash looping PodSet waits before creating
+// pods again, 0 if it is not backing off. The backoff of a PodSet is reset once its
+// pods stopped failing for twice the maximum backoff.
+func (r *PodSetReconciler) getCreationBackoff(podSet *pixiuv1alpha1.PodSet, crashLoop string) time.Duration {
+	key := getPodSetKey(podSet)
+	if len(crashLoop) == 0 || !r.Backoff.IsInBackOffSinceUpdate(key, r.Backoff.Clock.Now()) {
+		return 0
+	}
+	return r.Backoff.Get(key)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetCrashLoop(t *testing.T) {
+	now := time.Now()
+	recent := metav1.NewTime(now.Add(-time.Minute))
+	latest := metav1.NewTime(now.Add(-time.Second))
+	old := metav1.NewTime(now.Add(-time.Hour))
+	failed := func(reason string, finishedAt metav1.Time) corev1.Pod {
+		return corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: reason, ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "app",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", FinishedAt: finishedAt}},
+		}}}}
+	}
+	evicted := corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted", Message: "low on memory", StartTime: &recent}}
+	restarted := func(restarts int32, finishedAt metav1.Time) corev1.Pod {
+		return corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{{
+			Name:                 "app",
+			RestartCount:         restarts,
+			State:                corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled", FinishedAt: finishedAt}},
+		}}}}
+	}
+	terminating := failed("", recent)
+	terminating.DeletionTimestamp = &recent
+
+	tests := []struct {
+		name     string
+		pods     []corev1.Pod
+		expected string
+	}{
+		{
+			name:     "container restarted once",
+			pods:     []corev1.Pod{restarted(1, recent)},
+			expected: "",
+		},
+		{
+			name:     "single failed pod",
+			pods:     []corev1.Pod{failed("", recent)},
+			expected: "",
+		},
+		{
+			name:     "repeatedly failed pods",
+			pods:     []corev1.Pod{failed("", recent), failed("", latest), failed("", recent)},
+			expected: "3 pods failed in the last 10m0s, pod web-1: container app exited with code 1 (Error)",
+		},
+		{
+			name:     "pods failed long ago",
+			pods:     []corev1.Pod{failed("", recent), failed("", old), failed("", old)},
+			expected: "",
+		},
+		{
+			name:     "pods failed by their node",
+			pods:     []corev1.Pod{evicted, evicted, failed("Preempting", recent), failed("Shutdown", recent)},
+			expected: "",
+		},
+		{
+			name:     "evicted pods besides failed pods",
+			pods:     []corev1.Pod{failed("", recent), failed("", recent), evicted},
+			expected: "",
+		},
+		{
+			name: "container in CrashLoopBackOff",
+			pods: []corev1.Pod{{Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "app",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 40s"}},
+			}}}}},
+			expected: "pod web-0 is crash looping: container app: back-off 40s",
+		},
+		{
+			name:     "container restarted recently",
+			pods:     []corev1.Pod{restarted(3, recent)},
+			expected: "pod web-0 is crash looping: container app exited with code 137 (OOMKilled)",
+		},
+		{
+			name:     "container restarted long ago",
+			pods:     []corev1.Pod{restarted(3, old)},
+			expected: "",
+		},
+		{
+			name:     "terminating pods",
+			pods:     []corev1.Pod{terminating, terminating, terminating},
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		for i := range test.pods {
+			test.pods[i].Name = "web-" + strconv.Itoa(i)
+		}
+		if crashLoop := getCrashLoop(test.pods, now); crashLoop != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, crashLoop)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// createRetryPeriod is how long a PodSet waits before retrying pod creations which
+// were rejected by the API server, as they only succeed once the namespace or the
+// PodSet is fixed.
+const createRetryPeriod = time.Minute
+
+var (
+	exceededQuotaRegexp = regexp.MustCompile(`exceeded quota: ([^,]+)`)
+	limitRangeRegexp    = regexp.MustCompile(`(maximum|minimum) .* per (Container|Pod|PersistentVolumeClaim)|(limit|request) to (limit|request) ratio`)
+)
+
+// createError is a pod creation rejected by the API server, classified by reason.
+type createError struct {
+	reason  string
+	message string
+	err     error
+}
+
+func (e *createError) Error() string {
+	return e.err.Error()
+}
+
+func (e *createError) Unwrap() error {
+	return e.err
+}
+
+// classifyCreateError tells why the API server rejected a pod creation: an exceeded
+// quota, a limit range, another admission plugin, an invalid pod or a terminating
+// namespace. The other errors are returned as is.
+func classifyCreateError(err error) error {
+	message := err.Error()
+	switch {
+	case apierrors.HasStatusCause(err, corev1.NamespaceTerminatingCause):
+		return &createError{reason: pixiutypes.NamespaceTerminatingReason, message: message, err: err}
+	case apierrors.IsForbidden(err):
+		if match := exceededQuotaRegexp.FindStringSubmatch(message); match != nil {
+			quota := strings.TrimSpace(match[1])
+			return &createError{reason: pixiutypes.QuotaExceededReason, message: fmt.Sprintf("Quota %s exceeded: %s", quota, message), err: err}
+		}
+		if limitRangeRegexp.MatchString(message) {
+			return &createError{reason: pixiutypes.LimitRangeViolatedReason, message: message, err: err}
+		}
+		return &createError{reason: pixiutypes.AdmissionForbiddenReason, message: message, err: err}
+	case apierrors.IsInvalid(err):
+		return &createError{reason: pixiutypes.InvalidPodReason, message: message, err: err}
+	}
+	return err
+}
+
+// getCreateError returns the classified pod creation failure wrapped in err, if any.
+func getCreateError(err error) *createError {
+	var cerr *createError
+	if errors.As(err, &cerr) {
+		return cerr
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+func TestClassifyCreateError(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	terminating := apierrors.NewForbidden(pods, "web-0", errors.New("unable to create new content in namespace default because it is being terminated"))
+	terminating.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: corev1.NamespaceTerminatingCause}}
+
+	tests := []struct {
+		name    string
+		err     error
+		reason  string
+		message string
+	}{
+		{
+			name:   "namespace terminating",
+			err:    terminating,
+			reason: pixiutypes.NamespaceTerminatingReason,
+		},
+		{
+			name:    "quota exceeded",
+			err:     apierrors.NewForbidden(pods, "web-0", errors.New("exceeded quota: compute, requested: cpu=1, used: cpu=4, limited: cpu=4")),
+			reason:  pixiutypes.QuotaExceededReason,
+			message: `Quota compute exceeded: pods "web-0" is forbidden: exceeded quota: compute, requested: cpu=1, used: cpu=4, limited: cpu=4`,
+		},
+		{
+			name:   "limit range violated",
+			err:    apierrors.NewForbidden(pods, "web-0", errors.New("maximum cpu usage per Container is 2, but limit is 4")),
+			reason: pixiutypes.LimitRangeViolatedReason,
+		},
+		{
+			name:   "limit range ratio violated",
+			err:    apierrors.NewForbidden(pods, "web-0", errors.New("cpu max limit to request ratio per Container is 2, but provided ratio is 4")),
+			reason: pixiutypes.LimitRangeViolatedReason,
+		},
+		{
+			name:   "admission forbidden",
+			err:    apierrors.NewForbidden(pods, "web-0", errors.New("violates PodSecurity \"restricted:latest\"")),
+			reason: pixiutypes.AdmissionForbiddenReason,
+		},
+		{
+			name:   "invalid pod",
+			err:    apierrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, "web-0", field.ErrorList{field.Required(field.NewPath("spec", "containers"), "")}),
+			reason: pixiutypes.InvalidPodReason,
+		},
+		{
+			name: "unclassified error",
+			err:  apierrors.NewServiceUnavailable("etcdserver: request timed out"),
+		},
+	}
+
+	for _, test := range tests {
+		err := classifyCreateError(test.err)
+		cerr := getCreateError(err)
+		if len(test.reason) == 0 {
+			if cerr != nil || err != test.err {
+				t.Errorf("%s: expected the error unchanged, got %v", test.name, err)
+			}
+			continue
+		}
+		if cerr == nil || cerr.reason != test.reason {
+			t.Errorf("%s: expected reason %s, got %v", test.name, test.reason, err)
+			continue
+		}
+		message := test.message
+		if len(message) == 0 {
+			message = test.err.Error()
+		}
+		if cerr.message != message {
+			t.Errorf("%s: expected message %q, got %q", test.name, message, cerr.message)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected the classified error to wrap %v", test.name, test.err)
+		}
+	}
+}
+
+func TestCalculateStatusFailureCondition(t *testing.T) {
+	r := &PodSetReconciler{}
+	ps := newTestPodSet("web", 2, pixiuv1alpha1.RandomPodIdentity)
+	quota := &createError{reason: pixiutypes.QuotaExceededReason, message: "Quota compute exceeded"}
+	limitRange := &createError{reason: pixiutypes.LimitRangeViolatedReason, message: "limit range violated"}
+
+	steps := []struct {
+		name      string
+		err       error
+		crashLoop string
+		reason    string
+		message   string
+	}{
+		{name: "classified create error", err: quota, reason: pixiutypes.QuotaExceededReason, message: "Quota compute exceeded"},
+		{name: "different classified error", err: limitRange, reason: pixiutypes.LimitRangeViolatedReason, message: "limit range violated"},
+		{name: "unclassified error", err: errors.New("connection refused"), reason: "FailedCreate", message: "connection refused"},
+		{name: "same reason, new message", err: errors.New("timeout"), reason: "FailedCreate", message: "timeout"},
+		{name: "crash loop", crashLoop: "container app crashed", reason: pixiutypes.CrashLoopingReason, message: "container app crashed"},
+		{name: "creations succeed"},
+	}
+	for _, step := range steps {
+		status := r.calculateStatus(ps, nil, step.err, 0, step.crashLoop)
+		cond := GetCondition(status, pixiutypes.PodSetFailure)
+		if len(step.reason) == 0 {
+			if cond != nil {
+				t.Errorf("%s: expected no failure condition, got %+v", step.name, cond)
+			}
+		} else if cond == nil || cond.Status != corev1.ConditionTrue || cond.Reason != step.reason || cond.Message != step.message {
+			t.Errorf("%s: expected failure %s: %s, got %+v", step.name, step.reason, step.message, cond)
+		}
+		ps.Status = status
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// needsFinalizer returns true if the deletion of the PodSet has to wait for the
+// controller to handle its pods.
+func needsFinalizer(podSet *pixiuv1alpha1.PodSet) bool {
+	return podSet.Spec.DeletionPolicy == pixiuv1alpha1.OrphanDeletionPolicy || podSet.Spec.Teardown != nil
+}
+
+// syncFinalizer adds the finalizer to the PodSet if it needs one, and removes it
+// otherwise.
+func (r *PodSetReconciler) syncFinalizer(ctx context.Context, podSet *pixiuv1alpha1.PodSet) error {
+	hasFinalizer := controllerutil.ContainsFinalizer(podSet, pixiutypes.PodSetFinalizer)
+	switch need := needsFinalizer(podSet); {
+	case need && !hasFinalizer:
+		controllerutil.AddFinalizer(podSet, pixiutypes.PodSetFinalizer)
+	case !need && hasFinalizer:
+		controllerutil.RemoveFinalizer(podSet, pixiutypes.PodSetFinalizer)
+	default:
+		return nil
+	}
+
+	if err := r.Update(ctx, podSet); err != nil {
+		return fmt.Errorf("failed to update the finalizers of PodSet %s/%s: %v", podSet.Namespace, podSet.Name, err)
+	}
+	return nil
+}
+
+// finalizePodSet handles the pods of a deleted PodSet as requested by its deletion
+// policy and teardown, then removes the finalizer to let the PodSet go. It returns
+// how long to wait before resuming a throttled teardown, if any.
+func (r *PodSetReconciler) finalizePodSet(ctx context.Context, podSet *pixiuv1alpha1.PodSet, pods []corev1.Pod) (time.Duration, error) {
+	if !controllerutil.ContainsFinalizer(podSet, pixiutypes.PodSetFinalizer) {
+		return 0, nil
+	}
+	switch {
+	case podSet.Spec.DeletionPolicy == pixiuv1alpha1.OrphanDeletionPolicy:
+		if err := r.orphanPods(ctx, podSet, pods); err != nil {
+			return 0, err
+		}
+	case podSet.Spec.Teardown != nil:
+		done, throttle, err := r.teardownPods(ctx, podSet, pods)
+		if err != nil || !done {
+			return throttle, err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(podSet, pixiutypes.PodSetFinalizer)
+	if err := r.Update(ctx, podSet); err != nil && !apierrors.IsNotFound(err) {
+		return 0, fmt.Errorf("failed to remove the finalizer of PodSet %s/%s: %v", podSet.Namespace, podSet.Name, err)
+	}
+	return 0, nil
+}
+
+// orphanPods removes the PodSet owner references from its pods and their claims, so
+// that they are not garbage collected with the PodSet.
+func (r *PodSetReconciler) orphanPods(ctx context.Context, podSet *pixiuv1alpha1.PodSet, pods []corev1.Pod) error {
+	var errs []error
+	for i := range pods {
+		if err := r.releasePod(ctx, podSet, &pods[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, claims, client.InNamespace(podSet.Namespace), client.MatchingLabels{pixiutypes.PodSetNameLabel: podSet.Name}); err != nil {
+		return fmt.Errorf("failed to list claims: %v", err)
+	}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		index := hasOwnerRef(claim, podSet.UID)
+		if index < 0 {
+			continue
+		}
+		claim.OwnerReferences = append(claim.OwnerReferences[:index], claim.OwnerReferences[index+1:]...)
+		if err := r.Update(ctx, claim); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to orphan claim %s/%s: %v", claim.Namespace, claim.Name, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		r.Log.Info("Orphaned pods of deleted PodSet", "podSet", klog.KObj(podSet), "pods", len(pods))
+	}
+	return utilerrors.NewAggregate(errs)
+}
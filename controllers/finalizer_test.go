@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+func TestNeedsFinalizer(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   pixiuv1alpha1.DeletionPolicyType
+		teardown *pixiuv1alpha1.PodSetTeardown
+		expected bool
+	}{
+		{name: "default policy", expected: false},
+		{name: "delete policy", policy: pixiuv1alpha1.DeletePodsDeletionPolicy, expected: false},
+		{name: "orphan policy", policy: pixiuv1alpha1.OrphanDeletionPolicy, expected: true},
+		{name: "teardown", teardown: &pixiuv1alpha1.PodSetTeardown{}, expected: true},
+	}
+
+	for _, test := range tests {
+		ps := newTestPodSet("web", 1, pixiuv1alpha1.RandomPodIdentity)
+		ps.Spec.DeletionPolicy = test.policy
+		ps.Spec.Teardown = test.teardown
+		if got := needsFinalizer(ps); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+// failingPatches fails the patches of all the objects.
+type failingPatches struct {
+	client.Client
+}
+
+func (c *failingPatches) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return errors.New("connection refused")
+}
+
+func TestFinalizePodSetOrphan(t *testing.T) {
+	now := metav1.Now()
+	ps := newTestPodSet("web", 2, pixiuv1alpha1.OrdinalPodIdentity)
+	ps.UID = "web"
+	ps.DeletionTimestamp = &now
+	ps.Finalizers = []string{pixiutypes.PodSetFinalizer}
+	ps.Spec.DeletionPolicy = pixiuv1alpha1.OrphanDeletionPolicy
+	owner := *metav1.NewControllerRef(ps, pixiuv1alpha1.GroupVersionKind)
+	other := metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "other"}
+
+	newPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			UID:             types.UID(name),
+			Labels:          map[string]string{"app": "web"},
+			OwnerReferences: []metav1.OwnerReference{owner},
+		}}
+	}
+	newClaim := func(name, podSet string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			Labels:          map[string]string{pixiutypes.PodSetNameLabel: podSet},
+			OwnerReferences: []metav1.OwnerReference{owner, other},
+		}}
+	}
+
+	for _, failing := range []bool{false, true} {
+		pods := []*corev1.Pod{newPod("web-0"), newPod("web-1")}
+		r := newTestReconciler(ps.DeepCopy(), pods[0], pods[1], newClaim("data-web-0", "web"), newClaim("data-db-0", "db"))
+		if failing {
+			r.Client = &failingPatches{Client: r.Client}
+		}
+		podSet := &pixiuv1alpha1.PodSet{}
+		if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "web"}, podSet); err != nil {
+			t.Fatalf("failed to get the PodSet: %v", err)
+		}
+
+		_, err := r.finalizePodSet(context.TODO(), podSet, []corev1.Pod{*pods[0], *pods[1]})
+		if failing != (err != nil) {
+			t.Errorf("failing %v: expected error %v, got %v", failing, failing, err)
+		}
+
+		// The PodSet goes once its pods are released.
+		current := &pixiuv1alpha1.PodSet{}
+		err = r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "web"}, current)
+		switch {
+		case err != nil && !apierrors.IsNotFound(err):
+			t.Errorf("failing %v: failed to get the PodSet: %v", failing, err)
+		case failing && (err != nil || !controllerutil.ContainsFinalizer(current, pixiutypes.PodSetFinalizer)):
+			t.Errorf("failing %v: expected the finalizer kept until the pods are released", failing)
+		case !failing && err == nil && controllerutil.ContainsFinalizer(current, pixiutypes.PodSetFinalizer):
+			t.Errorf("failing %v: expected the finalizer removed", failing)
+		}
+		if failing {
+			continue
+		}
+
+		for _, pod := range pods {
+			current := &corev1.Pod{}
+			if err := r.Get(context.TODO(), client.ObjectKeyFromObject(pod), current); err != nil {
+				t.Errorf("failed to get pod %s: %v", pod.Name, err)
+			} else if len(current.OwnerReferences) != 0 {
+				t.Errorf("expected pod %s released, got owners %v", pod.Name, current.OwnerReferences)
+			}
+		}
+		claims := map[string][]metav1.OwnerReference{
+			"data-web-0": {other},
+			"data-db-0":  {owner, other},
+		}
+		for name, expected := range claims {
+			claim := &corev1.PersistentVolumeClaim{}
+			if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: name}, claim); err != nil {
+				t.Errorf("failed to get claim %s: %v", name, err)
+			} else if len(claim.OwnerReferences) != len(expected) || claim.OwnerReferences[0].UID != expected[0].UID {
+				t.Errorf("expected claim %s owned by %v, got %v", name, expected, claim.OwnerReferences)
+			}
+		}
+	}
+}
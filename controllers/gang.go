@@ -0,0 +1,212 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+//+kubebuilder:rbac:groups=scheduling.sigs.k8s.io,resources=podgroups,verbs=get;create;update;delete
+
+// podGroupGVK is the PodGroup of the coscheduling plugin of the scheduler-plugins
+// project, handled as unstructured so that its CRD is only needed by gang scheduled
+// PodSets.
+var podGroupGVK = schema.GroupVersionKind{Group: "scheduling.sigs.k8s.io", Version: "v1alpha1", Kind: "PodGroup"}
+
+// getGangMinMember returns the number of pods the gang of the PodSet needs running.
+func getGangMinMember(podSet *pixiuv1alpha1.PodSet) int {
+	if podSet.Spec.Gang.MinMember != nil {
+		return int(*podSet.Spec.Gang.MinMember)
+	}
+	return int(desiredReplicas(podSet))
+}
+
+func getGangTimeout(podSet *pixiuv1alpha1.PodSet) time.Duration {
+	return time.Duration(podSet.Spec.Gang.TimeoutSeconds) * time.Second
+}
+
+// isGangRunning returns true if enough pods of the gang are running.
+func isGangRunning(podSet *pixiuv1alpha1.PodSet, filteredPods []*corev1.Pod) bool {
+	running := 0
+	for _, pod := range filteredPods {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			running++
+		}
+	}
+	return running >= getGangMinMember(podSet)
+}
+
+func newPodGroup() *unstructured.Unstructured {
+	podGroup := &unstructured.Unstructured{}
+	podGroup.SetGroupVersionKind(podGroupGVK)
+	return podGroup
+}
+
+// syncPodGroup creates or updates the PodGroup holding the pods of the gang, named
+// after the PodSet.
+func (r *PodSetReconciler) syncPodGroup(ctx context.Context, podSet *pixiuv1alpha1.PodSet) error {
+	minMember := int64(getGangMinMember(podSet))
+	timeout := int64(podSet.Spec.Gang.TimeoutSeconds)
+
+	podGroup := newPodGroup()
+	err := r.Get(ctx, types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}, podGroup)
+	if apierrors.IsNotFound(err) {
+		podGroup = newPodGroup()
+		podGroup.SetNamespace(podSet.Namespace)
+		podGroup.SetName(podSet.Name)
+		podGroup.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(podSet, pixiuv1alpha1.GroupVersionKind)})
+		if err = unstructured.SetNestedField(podGroup.Object, minMember, "spec", "minMember"); err != nil {
+			return err
+		}
+		if err = unstructured.SetNestedField(podGroup.Object, timeout, "spec", "scheduleTimeoutSeconds"); err != nil {
+			return err
+		}
+		return r.Create(ctx, podGroup)
+	}
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return fmt.Errorf("gang scheduling needs the PodGroup CRD of the coscheduling plugin: %v", err)
+		}
+		return err
+	}
+
+	currentMinMember, _, _ := unstructured.NestedInt64(podGroup.Object, "spec", "minMember")
+	currentTimeout, _, _ := unstructured.NestedInt64(podGroup.Object, "spec", "scheduleTimeoutSeconds")
+	if currentMinMember == minMember && currentTimeout == timeout {
+		return nil
+	}
+	if err = unstructured.SetNestedField(podGroup.Object, minMember, "spec", "minMember"); err != nil {
+		return err
+	}
+	if err = unstructured.SetNestedField(podGroup.Object, timeout, "spec", "scheduleTimeoutSeconds"); err != nil {
+		return err
+	}
+	return r.Update(ctx, podGroup)
+}
+
+// deletePodGroup deletes the PodGroup of a PodSet which is no longer gang scheduled.
+func (r *PodSetReconciler) deletePodGroup(ctx context.Context, podSet *pixiuv1alpha1.PodSet) error {
+	podGroup := newPodGroup()
+	podGroup.SetNamespace(podSet.Namespace)
+	podGroup.SetName(podSet.Name)
+	if err := r.Delete(ctx, podGroup); err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return err
+	}
+	return nil
+}
+
+// manageGang keeps the PodGroup of a gang scheduled PodSet in sync, and deletes all
+// the pods of the gang once it waited for them to run longer than its timeout, so
+// that a partial gang does not hold its nodes. The PodGroup of a PodSet no longer
+// gang scheduled is deleted while the GangScheduled condition tracks it. It returns
+// true while the gang is torn down, and how long until the gang times out if it is
+// waiting, or until the teardown held back by the rate limits can go on.
+func (r *PodSetReconciler) manageGang(ctx context.Context, filteredPods []*corev1.Pod, podSet *pixiuv1alpha1.PodSet) (bool, time.Duration, error) {
+	if podSet.Spec.Gang == nil {
+		if GetCondition(podSet.Status, pixiutypes.PodSetGangScheduled) != nil {
+			if err := r.deletePodGroup(ctx, podSet); err != nil {
+				return false, 0, fmt.Errorf("failed to delete the pod group of %s/%s: %v", podSet.Namespace, podSet.Name, err)
+			}
+		}
+		return false, 0, nil
+	}
+	if err := r.syncPodGroup(ctx, podSet); err != nil {
+		return false, 0, err
+	}
+	if desiredReplicas(podSet) == 0 || isGangRunning(podSet, filteredPods) {
+		return false, 0, nil
+	}
+
+	// The gang waits since the condition is set, starting with this sync otherwise.
+	timeout := getGangTimeout(podSet)
+	cond := GetCondition(podSet.Status, pixiutypes.PodSetGangScheduled)
+	var gang []*corev1.Pod
+	switch {
+	case cond != nil && cond.Reason == pixiutypes.WaitingForGangReason:
+		if remaining := timeout - time.Since(cond.LastTransitionTime.Time); remaining > 0 {
+			return false, remaining, nil
+		}
+		if len(filteredPods) == 0 {
+			return false, 0, nil
+		}
+		gang = filteredPods
+		r.Recorder.Eventf(podSet, corev1.EventTypeWarning, pixiutypes.GangTimeoutReason, "Deleting the %d pods of the gang, less than %d running after %v", len(gang), getGangMinMember(podSet), timeout)
+	case cond != nil && cond.Reason == pixiutypes.GangTimeoutReason:
+		// The pods of the timed out gang held back by the rate limits are older than
+		// the teardown.
+		for _, pod := range filteredPods {
+			if pod.CreationTimestamp.Before(&cond.LastTransitionTime) {
+				gang = append(gang, pod)
+			}
+		}
+		if len(gang) == 0 {
+			return false, timeout, nil
+		}
+	default:
+		return false, timeout, nil
+	}
+
+	granted, throttle := r.throttle(podSet, len(gang))
+	r.Log.Info("Tearing down gang", "podSet", klog.KObj(podSet), "remaining", len(gang), "deleting", granted)
+	if err := r.deletePods(ctx, podSet, gang[:granted]); err != nil {
+		return true, throttle, err
+	}
+	return true, throttle, nil
+}
+
+// setGangCondition tells whether the gang of the PodSet runs, waits for its pods, or
+// is torn down, which starts a new wait once done. The condition of a PodSet no longer
+// gang scheduled is only removed once its PodGroup is deleted, the gang error tells.
+func setGangCondition(podSet *pixiuv1alpha1.PodSet, status *pixiuv1alpha1.PodSetStatus, filteredPods []*corev1.Pod, tornDown bool, gangErr error) {
+	if podSet.Spec.Gang == nil {
+		if gangErr == nil {
+			RemoveCondition(status, pixiutypes.PodSetGangScheduled)
+		}
+		return
+	}
+	if desiredReplicas(podSet) == 0 {
+		SetCondition(status, NewReplicaSetCondition(pixiutypes.PodSetGangScheduled, corev1.ConditionFalse, pixiutypes.GangScaledDownReason,
+			"the PodSet has no replicas"))
+		return
+	}
+	minMember := getGangMinMember(podSet)
+	switch {
+	case tornDown:
+		SetCondition(status, NewReplicaSetCondition(pixiutypes.PodSetGangScheduled, corev1.ConditionFalse, pixiutypes.GangTimeoutReason,
+			fmt.Sprintf("less than %d pods were running after %v", minMember, getGangTimeout(podSet))))
+	case isGangRunning(podSet, filteredPods):
+		SetCondition(status, NewReplicaSetCondition(pixiutypes.PodSetGangScheduled, corev1.ConditionTrue, pixiutypes.GangRunningReason,
+			fmt.Sprintf("at least %d pods are running", minMember)))
+	default:
+		SetCondition(status, NewReplicaSetCondition(pixiutypes.PodSetGangScheduled, corev1.ConditionFalse, pixiutypes.WaitingForGangReason,
+			fmt.Sprintf("waiting for %d pods to run", minMember)))
+	}
+}
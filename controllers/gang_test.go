@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+func TestSetGangCondition(t *testing.T) {
+	running := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+	tests := []struct {
+		name     string
+		gang     bool
+		replicas int32
+		pods     []*corev1.Pod
+		tornDown bool
+		gangErr  error
+		expected string
+	}{
+		{name: "no gang", expected: ""},
+		{name: "pod group not deleted", gangErr: errors.New("forbidden"), expected: pixiutypes.WaitingForGangReason},
+		{name: "scaled down", gang: true, expected: pixiutypes.GangScaledDownReason},
+		{name: "torn down", gang: true, replicas: 1, tornDown: true, expected: pixiutypes.GangTimeoutReason},
+		{name: "running", gang: true, replicas: 1, pods: []*corev1.Pod{running}, expected: pixiutypes.GangRunningReason},
+		{name: "waiting", gang: true, replicas: 2, pods: []*corev1.Pod{running}, expected: pixiutypes.WaitingForGangReason},
+	}
+
+	for _, test := range tests {
+		podSet := newTestPodSet("web", test.replicas, pixiuv1alpha1.RandomPodIdentity)
+		if test.gang {
+			podSet.Spec.Gang = &pixiuv1alpha1.PodSetGang{TimeoutSeconds: 60}
+		}
+		status := pixiuv1alpha1.PodSetStatus{}
+		SetCondition(&status, NewReplicaSetCondition(pixiutypes.PodSetGangScheduled, corev1.ConditionFalse, pixiutypes.WaitingForGangReason, ""))
+		setGangCondition(podSet, &status, test.pods, test.tornDown, test.gangErr)
+
+		reason := ""
+		if cond := GetCondition(status, pixiutypes.PodSetGangScheduled); cond != nil {
+			reason = cond.Reason
+		}
+		if reason != test.expected {
+			t.Errorf("%s: expected reason %q, got %q", test.name, test.expected, reason)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog/v2"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+const NotReadyTimeoutReason = "NotReadyTimeout"
+
+// getNotReadySince returns since when the running pod is not ready. It returns false
+// if the pod is ready, or not running.
+func getNotReadySince(pod *corev1.Pod) (time.Time, bool) {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return time.Time{}, false
+	}
+	c := GetPodReadyCondition(pod.Status)
+	if c == nil || c.Status == corev1.ConditionTrue || c.LastTransitionTime.IsZero() {
+		return time.Time{}, false
+	}
+	return c.LastTransitionTime.Time, true
+}
+
+func getMaxNotReady(podSet *pixiuv1alpha1.PodSet) time.Duration {
+	if podSet.Spec.HealthPolicy == nil {
+		return 0
+	}
+	return time.Duration(podSet.Spec.HealthPolicy.MaxNotReadySeconds) * time.Second
+}
+
+// getMaxConcurrentHeals returns the maximum number of pods healed at once. Percentages
+// are rounded up, so that the pods of small PodSets are healed too.
+func getMaxConcurrentHeals(podSet *pixiuv1alpha1.PodSet) int {
+	maxConcurrentHeals := intstr.FromInt(1)
+	if podSet.Spec.HealthPolicy.MaxConcurrentHeals != nil {
+		maxConcurrentHeals = *podSet.Spec.HealthPolicy.MaxConcurrentHeals
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(&maxConcurrentHeals, int(*podSet.Spec.Replicas), true)
+	if err != nil {
+		return 1
+	}
+	return value
+}
+
+// healPods deletes the pods running but not ready for longer than the health policy
+// of the PodSet allows, they are recreated by the next sync. The pods already being
+// healed, that is the missing pods and the not ready pods not yet past the timeout,
+// count against the concurrent heals. It returns how long to wait for the heals held
+// back by the rate limits, if any.
+func (r *PodSetReconciler) healPods(ctx context.Context, filteredPods []*corev1.Pod, podSet *pixiuv1alpha1.PodSet) (time.Duration, error) {
+	maxNotReady := getMaxNotReady(podSet)
+	if maxNotReady <= 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	var wedged []*corev1.Pod
+	healing := int(desiredReplicas(podSet)) - len(filteredPods)
+	for _, pod := range filteredPods {
+		if IsPodReady(pod) {
+			continue
+		}
+		if since, ok := getNotReadySince(pod); ok && now.Sub(since) >= maxNotReady {
+			wedged = append(wedged, pod)
+		} else {
+			healing++
+		}
+	}
+	budget := getMaxConcurrentHeals(podSet) - healing
+	if len(wedged) == 0 || budget <= 0 {
+		return 0, nil
+	}
+	if len(wedged) > budget {
+		wedged = wedged[:budget]
+	}
+
+	granted, throttle := r.throttle(podSet, len(wedged))
+	wedged = wedged[:granted]
+	for _, pod := range wedged {
+		r.Recorder.Eventf(podSet, corev1.EventTypeWarning, NotReadyTimeoutReason, "Replacing pod %s running but not ready for more than %v", pod.Name, maxNotReady)
+	}
+	r.Log.Info("Healing not ready pods", "podSet", klog.KObj(podSet), "deleting", len(wedged))
+	if err := r.deletePods(ctx, podSet, wedged); err != nil {
+		return throttle, err
+	}
+	return throttle, nil
+}
+
+// getNextNotReadyTimeout returns how long until the next not ready pod of the PodSet
+// is past the health policy, 0 if none is not ready.
+func getNextNotReadyTimeout(podSet *pixiuv1alpha1.PodSet, filteredPods []*corev1.Pod) time.Duration {
+	maxNotReady := getMaxNotReady(podSet)
+	if maxNotReady <= 0 {
+		return 0
+	}
+
+	var next time.Duration
+	for _, pod := range filteredPods {
+		since, ok := getNotReadySince(pod)
+		if !ok {
+			continue
+		}
+		if remaining := maxNotReady - time.Since(since); remaining > 0 && (next == 0 || remaining < next) {
+			next = remaining
+		}
+	}
+	return next
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+func TestGetMaxConcurrentHeals(t *testing.T) {
+	tests := []struct {
+		replicas           int32
+		maxConcurrentHeals *intstr.IntOrString
+		expected           int
+	}{
+		{replicas: 3, expected: 1},
+		{replicas: 3, maxConcurrentHeals: intOrStringPtr(intstr.FromString("25%")), expected: 1},
+		{replicas: 10, maxConcurrentHeals: intOrStringPtr(intstr.FromString("25%")), expected: 3},
+		{replicas: 8, maxConcurrentHeals: intOrStringPtr(intstr.FromString("25%")), expected: 2},
+		{replicas: 10, maxConcurrentHeals: intOrStringPtr(intstr.FromInt(4)), expected: 4},
+		{replicas: 10, maxConcurrentHeals: intOrStringPtr(intstr.FromInt(0)), expected: 0},
+	}
+
+	for _, test := range tests {
+		ps := newTestPodSet("web", test.replicas, pixiuv1alpha1.RandomPodIdentity)
+		ps.Spec.HealthPolicy = &pixiuv1alpha1.PodSetHealthPolicy{MaxNotReadySeconds: 60, MaxConcurrentHeals: test.maxConcurrentHeals}
+		if got := getMaxConcurrentHeals(ps); got != test.expected {
+			t.Errorf("%d replicas, max concurrent heals %v: expected %d, got %d", test.replicas, test.maxConcurrentHeals, test.expected, got)
+		}
+	}
+}
+
+func intOrStringPtr(value intstr.IntOrString) *intstr.IntOrString {
+	return &value
+}
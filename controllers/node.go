@@ -0,0 +1,205 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+const (
+	ForceDeletePodReason = "ForceDeletePod"
+)
+
+// getNodeNotReadySince returns since when the node is not ready, which includes the
+// unreachable nodes whose Ready condition is Unknown. It returns false if the node
+// is ready.
+func getNodeNotReadySince(node *corev1.Node) (time.Time, bool) {
+	for _, c := range node.Status.Conditions {
+		if c.Type != corev1.NodeReady {
+			continue
+		}
+		if c.Status == corev1.ConditionTrue {
+			return time.Time{}, false
+		}
+		return c.LastTransitionTime.Time, true
+	}
+	return node.CreationTimestamp.Time, true
+}
+
+// forceDeletePods force deletes the terminating pods of the PodSet which are past
+// their grace period on a node NotReady for longer than the threshold of the PodSet,
+// or on a node which is gone. It returns how long until the next terminating pod may
+// be force deleted, 0 if none.
+func (r *PodSetReconciler) forceDeletePods(ctx context.Context, pods []corev1.Pod, podSet *pixiuv1alpha1.PodSet) (time.Duration, error) {
+	if podSet.Spec.ForceDeletion == nil {
+		return 0, nil
+	}
+	threshold := time.Duration(podSet.Spec.ForceDeletion.NodeNotReadySeconds) * time.Second
+
+	now := time.Now()
+	var next time.Duration
+	var errs []error
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp == nil || len(pod.Spec.NodeName) == 0 {
+			continue
+		}
+
+		wait := pod.DeletionTimestamp.Sub(now)
+		reason := fmt.Sprintf("node %s is gone", pod.Spec.NodeName)
+		node := &corev1.Node{}
+		if err := r.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node); err == nil {
+			notReadySince, notReady := getNodeNotReadySince(node)
+			if !notReady {
+				continue
+			}
+			if remaining := threshold - now.Sub(notReadySince); remaining > wait {
+				wait = remaining
+			}
+			reason = fmt.Sprintf("node %s is not ready since %s", node.Name, notReadySince.Format(time.RFC3339))
+		} else if !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to get node %s: %v", pod.Spec.NodeName, err))
+			continue
+		}
+
+		if wait > 0 {
+			if next == 0 || wait < next {
+				next = wait
+			}
+			continue
+		}
+		if err := r.Delete(ctx, pod, client.GracePeriodSeconds(0), client.Preconditions{UID: &pod.UID}); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to force delete pod %s/%s: %v", pod.Namespace, pod.Name, err))
+			continue
+		}
+		r.Recorder.Eventf(podSet, corev1.EventTypeWarning, ForceDeletePodReason, "Force deleted pod %s stuck terminating, %s", pod.Name, reason)
+	}
+
+	return next, utilerrors.NewAggregate(errs)
+}
+
+// podNodeNameField indexes the pods by the name of their node.
+const podNodeNameField = "spec.nodeName"
+
+func indexPodNodeName(obj client.Object) []string {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || len(pod.Spec.NodeName) == 0 {
+		return nil
+	}
+	return []string{pod.Spec.NodeName}
+}
+
+// isNodeFailed returns true if the node is NotReady, unreachable, or tainted as such
+// by the node lifecycle controller.
+func isNodeFailed(node *corev1.Node) bool {
+	if _, notReady := getNodeNotReadySince(node); notReady {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == corev1.TaintNodeUnreachable || taint.Key == corev1.TaintNodeNotReady {
+			return true
+		}
+	}
+	return false
+}
+
+// mapNodeToPodSets enqueues the PodSets with a pod on the failed node. The update of a
+// node is mapped for both its old and new object, so that the PodSets are enqueued
+// once more when the node recovers, and drop the pods surged to replace its pods.
+func (r *PodSetReconciler) mapNodeToPodSets(obj client.Object) (requests []reconcile.Request) {
+	node, ok := obj.(*corev1.Node)
+	if !ok || !isNodeFailed(node) {
+		return
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(context.TODO(), pods, client.MatchingFields{podNodeNameField: node.Name}); err != nil {
+		return
+	}
+	seen := make(map[types.NamespacedName]bool)
+	for i := range pods.Items {
+		controllerRef := metav1.GetControllerOf(&pods.Items[i])
+		if controllerRef == nil || !isPodSetRef(controllerRef) {
+			continue
+		}
+		key := types.NamespacedName{Namespace: pods.Items[i].Namespace, Name: controllerRef.Name}
+		if !seen[key] {
+			seen[key] = true
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return
+}
+
+// isPodSetRef returns true if the owner reference refers to a PodSet, rather than to
+// a kind of the same name of another group.
+func isPodSetRef(ref *metav1.OwnerReference) bool {
+	if ref.Kind != pixiutypes.PodSetKind {
+		return false
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	return err == nil && gv.Group == pixiuv1alpha1.GroupVersion.Group
+}
+
+// getPodsOnFailedNodes returns the pods of a Surge PodSet running on a failed node,
+// they are replaced before being evicted.
+func (r *PodSetReconciler) getPodsOnFailedNodes(ctx context.Context, filteredPods []*corev1.Pod, podSet *pixiuv1alpha1.PodSet) (map[*corev1.Pod]bool, error) {
+	if podSet.Spec.NodeFailurePolicy != pixiuv1alpha1.SurgeNodeFailurePolicy || isOrdinal(podSet) {
+		return nil, nil
+	}
+
+	failedNodes := make(map[string]bool)
+	lost := make(map[*corev1.Pod]bool)
+	for _, pod := range filteredPods {
+		nodeName := pod.Spec.NodeName
+		if len(nodeName) == 0 {
+			continue
+		}
+		failed, ok := failedNodes[nodeName]
+		if !ok {
+			node := &corev1.Node{}
+			if err := r.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return nil, fmt.Errorf("failed to get node %s: %v", nodeName, err)
+				}
+				// The pods of a deleted node are about to be collected.
+				failed = true
+			} else {
+				failed = isNodeFailed(node)
+			}
+			failedNodes[nodeName] = failed
+		}
+		if failed {
+			lost[pod] = true
+		}
+	}
+	return lost, nil
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+func newTestNode(name string, ready corev1.ConditionStatus) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}}},
+	}
+}
+
+func TestMapNodeToPodSets(t *testing.T) {
+	newPod := func(name, apiVersion, kind, owner string) *corev1.Pod {
+		controller := true
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: apiVersion, Kind: kind, Name: owner, UID: types.UID(owner), Controller: &controller},
+			}},
+			Spec: corev1.PodSpec{NodeName: "node-1"},
+		}
+	}
+	pods := []client.Object{
+		newPod("web-0", pixiuv1alpha1.GroupVersion.String(), pixiutypes.PodSetKind, "web"),
+		newPod("web-1", pixiuv1alpha1.GroupVersion.String(), pixiutypes.PodSetKind, "web"),
+		newPod("other-0", "example.com/v1", pixiutypes.PodSetKind, "other"),
+		newPod("rs-0", "apps/v1", "ReplicaSet", "rs"),
+	}
+	r := newTestReconciler(pods...)
+
+	tests := []struct {
+		name     string
+		node     *corev1.Node
+		expected []types.NamespacedName
+	}{
+		{name: "failed node", node: newTestNode("node-1", corev1.ConditionUnknown), expected: []types.NamespacedName{{Namespace: "default", Name: "web"}}},
+		{name: "ready node", node: newTestNode("node-1", corev1.ConditionTrue)},
+	}
+	for _, test := range tests {
+		var keys []types.NamespacedName
+		for _, request := range r.mapNodeToPodSets(test.node) {
+			keys = append(keys, request.NamespacedName)
+		}
+		if !reflect.DeepEqual(keys, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, keys)
+		}
+	}
+}
+
+// forceDeleteRecorder records the pods deleted without grace period, with the UID
+// precondition, by name.
+type forceDeleteRecorder struct {
+	client.Client
+	deleted []string
+}
+
+func (c *forceDeleteRecorder) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	options := &client.DeleteOptions{}
+	options.ApplyOptions(opts)
+	if options.GracePeriodSeconds != nil && *options.GracePeriodSeconds == 0 &&
+		options.Preconditions != nil && options.Preconditions.UID != nil && *options.Preconditions.UID == obj.GetUID() {
+		c.deleted = append(c.deleted, obj.GetName())
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestForceDeletePods(t *testing.T) {
+	now := time.Now()
+	newNode := func(name string, ready corev1.ConditionStatus, since time.Duration) *corev1.Node {
+		node := newTestNode(name, ready)
+		node.Status.Conditions[0].LastTransitionTime = metav1.NewTime(now.Add(-since))
+		return node
+	}
+	// newPod returns a pod on the node, past its grace period since the given duration,
+	// or still within it if negative.
+	newPod := func(name, node string, deleted time.Duration) corev1.Pod {
+		deletion := metav1.NewTime(now.Add(-deleted))
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name), DeletionTimestamp: &deletion, Finalizers: []string{"example.com/wait"}},
+			Spec:       corev1.PodSpec{NodeName: node},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		forceDeletion *pixiuv1alpha1.PodSetForceDeletion
+		pods          []corev1.Pod
+		deleted       []string
+		next          time.Duration
+	}{
+		{
+			name: "force deletion disabled",
+			pods: []corev1.Pod{newPod("gone", "gone", time.Hour)},
+		},
+		{
+			name:          "past the threshold",
+			forceDeletion: &pixiuv1alpha1.PodSetForceDeletion{NodeNotReadySeconds: 300},
+			pods: []corev1.Pod{
+				newPod("gone", "gone", time.Minute),
+				newPod("unreachable", "unreachable-10m", time.Minute),
+				newPod("not-ready", "not-ready-10m", time.Minute),
+				newPod("ready", "ready", time.Hour),
+			},
+			deleted: []string{"gone", "not-ready", "unreachable"},
+		},
+		{
+			name:          "within the threshold",
+			forceDeletion: &pixiuv1alpha1.PodSetForceDeletion{NodeNotReadySeconds: 300},
+			pods: []corev1.Pod{
+				newPod("unreachable", "unreachable-1m", time.Hour),
+				newPod("gone", "gone", time.Minute),
+			},
+			deleted: []string{"gone"},
+			next:    4 * time.Minute,
+		},
+		{
+			name:          "within the grace period",
+			forceDeletion: &pixiuv1alpha1.PodSetForceDeletion{NodeNotReadySeconds: 300},
+			pods: []corev1.Pod{
+				newPod("unreachable", "unreachable-10m", -time.Minute),
+				newPod("gone", "gone", -2*time.Minute),
+			},
+			next: time.Minute,
+		},
+		{
+			name:          "no threshold",
+			forceDeletion: &pixiuv1alpha1.PodSetForceDeletion{NodeNotReadySeconds: 0},
+			pods: []corev1.Pod{
+				newPod("unreachable", "unreachable-1m", time.Second),
+				func() corev1.Pod {
+					pod := newPod("running", "unreachable-10m", 0)
+					pod.DeletionTimestamp, pod.Finalizers = nil, nil
+					return pod
+				}(),
+			},
+			deleted: []string{"unreachable"},
+		},
+	}
+
+	for _, test := range tests {
+		ps := newTestPodSet("web", 3, pixiuv1alpha1.RandomPodIdentity)
+		ps.Spec.ForceDeletion = test.forceDeletion
+		objs := []client.Object{
+			newNode("ready", corev1.ConditionTrue, time.Hour),
+			newNode("unreachable-10m", corev1.ConditionUnknown, 10*time.Minute),
+			newNode("unreachable-1m", corev1.ConditionUnknown, time.Minute),
+			newNode("not-ready-10m", corev1.ConditionFalse, 10*time.Minute),
+		}
+		for i := range test.pods {
+			objs = append(objs, &test.pods[i])
+		}
+		r := newTestReconciler(objs...)
+		recorder := &forceDeleteRecorder{Client: r.Client}
+		r.Client = recorder
+
+		next, err := r.forceDeletePods(context.TODO(), test.pods, ps)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		sort.Strings(recorder.deleted)
+		if fmt.Sprint(recorder.deleted) != fmt.Sprint(test.deleted) {
+			t.Errorf("%s: expected %v force deleted, got %v", test.name, test.deleted, recorder.deleted)
+		}
+		if test.next == 0 && next != 0 || test.next != 0 && (next <= test.next-time.Second || next > test.next) {
+			t.Errorf("%s: expected the next force deletion in %v, got %v", test.name, test.next, next)
+		}
+	}
+}
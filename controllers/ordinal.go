@@ -0,0 +1,230 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+// ordinalPods sorts the pods of an ordinal PodSet by their identity.
+type ordinalPods struct {
+	// replicas are the pods with an ordinal in [0, replicas), indexed by ordinal.
+	replicas []*corev1.Pod
+	// condemned are the pods with an ordinal out of range, a duplicated ordinal or
+	// no ordinal at all, sorted by descending ordinal.
+	condemned []*corev1.Pod
+	// terminating is true if a condemned pod is being deleted.
+	terminating bool
+}
+
+func getOrdinalPods(pods []corev1.Pod, replicas int) ordinalPods {
+	result := ordinalPods{replicas: make([]*corev1.Pod, replicas)}
+	for i := range pods {
+		pod := &pods[i]
+		ordinal, ok := getPodOrdinal(pod)
+		if ok && ordinal < replicas && result.replicas[ordinal] == nil {
+			result.replicas[ordinal] = pod
+			continue
+		}
+		if pod.DeletionTimestamp == nil {
+			result.condemned = append(result.condemned, pod)
+		} else {
+			result.terminating = true
+		}
+	}
+
+	sort.SliceStable(result.condemned, func(i, j int) bool {
+		ordinalI, _ := getPodOrdinal(result.condemned[i])
+		ordinalJ, _ := getPodOrdinal(result.condemned[j])
+		return ordinalI > ordinalJ
+	})
+	return result
+}
+
+// parallelOperations returns all the pods to create and delete at once.
+func (o ordinalPods) parallelOperations() ([]int, []*corev1.Pod) {
+	var toCreate []int
+	var toDelete []*corev1.Pod
+	for ordinal, pod := range o.replicas {
+		switch {
+		case pod == nil:
+			toCreate = append(toCreate, ordinal)
+		case pod.DeletionTimestamp != nil:
+			// Wait for the pod to be gone before reusing its name.
+		case IsPodTerminated(pod):
+			// Free the name so that the ordinal is recreated on the next sync.
+			toDelete = append(toDelete, pod)
+		}
+	}
+	return toCreate, append(toDelete, o.condemned...)
+}
+
+// orderedOperations returns the next pod to create or delete. An ordinal is created
+// once all the ordinals below it are running and ready, and the highest condemned
+// pod is deleted once all the others are gone.
+func (o ordinalPods) orderedOperations() ([]int, []*corev1.Pod) {
+	for ordinal, pod := range o.replicas {
+		switch {
+		case pod == nil:
+			return []int{ordinal}, nil
+		case pod.DeletionTimestamp != nil:
+			return nil, nil
+		case IsPodTerminated(pod):
+			return nil, []*corev1.Pod{pod}
+		case !isRunningAndReady(pod):
+			return nil, nil
+		}
+	}
+	if o.terminating || len(o.condemned) == 0 {
+		return nil, nil
+	}
+	return nil, o.condemned[:1]
+}
+
+// getWaitingOrdinal returns the ordinal an OrderedReady PodSet waits on, nil if
+// all its pods are running and ready.
+func getWaitingOrdinal(podSet *pixiuv1alpha1.PodSet, filteredPods []*corev1.Pod) *int32 {
+	replicas := int(desiredReplicas(podSet))
+	byOrdinal := make(map[int]*corev1.Pod, len(filteredPods))
+	highest := -1
+	for _, pod := range filteredPods {
+		if ordinal, ok := getPodOrdinal(pod); ok {
+			byOrdinal[ordinal] = pod
+			if ordinal > highest {
+				highest = ordinal
+			}
+		}
+	}
+
+	for ordinal := 0; ordinal < replicas; ordinal++ {
+		if pod, ok := byOrdinal[ordinal]; !ok || !isRunningAndReady(pod) {
+			waiting := int32(ordinal)
+			return &waiting
+		}
+	}
+	if highest >= replicas {
+		waiting := int32(highest)
+		return &waiting
+	}
+	return nil
+}
+
+// isFailedReplica returns true if the pod is the terminated pod of an ordinal within
+// the replicas, which is replaced rather than removed.
+func isFailedReplica(pod *corev1.Pod, replicas int) bool {
+	ordinal, ok := getPodOrdinal(pod)
+	return ok && ordinal < replicas && IsPodTerminated(pod)
+}
+
+func hasFailedReplicas(pods []*corev1.Pod, replicas int) bool {
+	for _, pod := range pods {
+		if isFailedReplica(pod, replicas) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterFailedReplicas returns the pods which are not failed replicas.
+func filterFailedReplicas(pods []*corev1.Pod, replicas int) []*corev1.Pod {
+	var result []*corev1.Pod
+	for _, pod := range pods {
+		if !isFailedReplica(pod, replicas) {
+			result = append(result, pod)
+		}
+	}
+	return result
+}
+
+func isRunningAndReady(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodRunning && IsPodReady(pod)
+}
+
+func isOrderedReady(podSet *pixiuv1alpha1.PodSet) bool {
+	return podSet.Spec.PodManagementPolicy == pixiuv1alpha1.OrderedReadyPodManagement
+}
+
+// manageOrdinalReplicas creates the missing ordinals of the PodSet, replaces the
+// terminated ones with a pod of the same name, and removes the pods out of range
+// starting with the highest ordinal, either all at once or one at a time for an
+// OrderedReady PodSet. It returns how long to wait before retrying the pod
+// operations held back by the rate limits, if any. The creations are backed off
+// while the pods of the PodSet are crash looping.
+func (r *PodSetReconciler) manageOrdinalReplicas(ctx context.Context, pods []corev1.Pod, podSet *pixiuv1alpha1.PodSet, crashLoop string) (time.Duration, error) {
+	if len(podSet.Spec.VolumeClaimTemplates) > 0 {
+		if err := r.manageClaimRetention(ctx, pods, podSet); err != nil {
+			return 0, err
+		}
+	}
+
+	ordinals := getOrdinalPods(pods, int(desiredReplicas(podSet)))
+
+	var toCreate []int
+	var toDelete []*corev1.Pod
+	if isOrderedReady(podSet) {
+		toCreate, toDelete = ordinals.orderedOperations()
+	} else {
+		toCreate, toDelete = ordinals.parallelOperations()
+	}
+	// A failed ordinal is replaced by deleting its pod first, which is held with
+	// the creations.
+	if (len(toCreate) > 0 || hasFailedReplicas(toDelete, len(ordinals.replicas))) && r.holdCreations(podSet, crashLoop) {
+		toCreate = nil
+		toDelete = filterFailedReplicas(toDelete, len(ordinals.replicas))
+	}
+
+	operations := len(toCreate) + len(toDelete)
+	if operations == 0 {
+		return 0, nil
+	}
+	granted, throttle := r.throttle(podSet, operations)
+	if granted < len(toCreate) {
+		toCreate = toCreate[:granted]
+	}
+	if deletions := granted - len(toCreate); deletions < len(toDelete) {
+		toDelete = toDelete[:deletions]
+	}
+
+	if len(toCreate) > 0 {
+		r.Log.Info("Creating missing ordinals", "podSet", klog.KObj(podSet), "ordinals", toCreate)
+		successes, err := r.createPodsInBatch(len(toCreate), 1, func(index int) error {
+			ordinal := toCreate[index]
+			return r.createPod(ctx, podSet.Namespace, &podSet.Spec.Template, podSet, metav1.NewControllerRef(podSet, pixiuv1alpha1.GroupVersionKind), ordinal, podPlacement{domain: getOrdinalDomain(podSet, ordinal)})
+		})
+		if err != nil {
+			// The deletions are not run either.
+			r.Governor.Return(podSet.Namespace, podSet.Name, len(toCreate)-successes+len(toDelete))
+			return throttle, err
+		}
+	}
+	if len(toDelete) > 0 {
+		r.Log.Info("Deleting terminated or condemned ordinals", "podSet", klog.KObj(podSet), "deleting", len(toDelete))
+		if err := r.deletePods(ctx, podSet, toDelete); err != nil {
+			return throttle, err
+		}
+	}
+
+	return throttle, nil
+}
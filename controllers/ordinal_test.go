@@ -0,0 +1,183 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// testOrdinalPod describes a pod of an ordinal PodSet, an ordinal below 0 leaves
+// the pod without its ordinal label.
+type testOrdinalPod struct {
+	ordinal  int
+	phase    corev1.PodPhase
+	ready    bool
+	deleting bool
+}
+
+func newTestOrdinalPods(specs []testOrdinalPod) []corev1.Pod {
+	pods := make([]corev1.Pod, 0, len(specs))
+	for i, spec := range specs {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-" + strconv.Itoa(i), Labels: map[string]string{}},
+			Status:     corev1.PodStatus{Phase: spec.phase},
+		}
+		if spec.ordinal >= 0 {
+			pod.Labels[pixiutypes.PodSetOrdinalLabel] = strconv.Itoa(spec.ordinal)
+		}
+		if spec.ready {
+			pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+		if spec.deleting {
+			now := metav1.Now()
+			pod.DeletionTimestamp = &now
+		}
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+func podNames(pods []*corev1.Pod) []string {
+	var names []string
+	for _, pod := range pods {
+		if pod == nil {
+			names = append(names, "")
+			continue
+		}
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func TestGetOrdinalPods(t *testing.T) {
+	tests := []struct {
+		name             string
+		pods             []testOrdinalPod
+		replicas         int
+		expectedReplicas []string
+		condemned        []string
+		terminating      bool
+	}{
+		{
+			name:             "missing ordinal",
+			pods:             []testOrdinalPod{{ordinal: 0}, {ordinal: 2}},
+			replicas:         3,
+			expectedReplicas: []string{"pod-0", "", "pod-1"},
+		},
+		{
+			name:             "out of range, duplicated and unlabeled pods",
+			pods:             []testOrdinalPod{{ordinal: 3}, {ordinal: 0}, {ordinal: 0}, {ordinal: -1}, {ordinal: 5}},
+			replicas:         1,
+			expectedReplicas: []string{"pod-1"},
+			condemned:        []string{"pod-4", "pod-0", "pod-2", "pod-3"},
+		},
+		{
+			name:             "terminating condemned pod",
+			pods:             []testOrdinalPod{{ordinal: 0}, {ordinal: 1, deleting: true}},
+			replicas:         1,
+			expectedReplicas: []string{"pod-0"},
+			terminating:      true,
+		},
+	}
+
+	for _, test := range tests {
+		result := getOrdinalPods(newTestOrdinalPods(test.pods), test.replicas)
+		if names := podNames(result.replicas); !reflect.DeepEqual(names, test.expectedReplicas) {
+			t.Errorf("%s: expected replicas %v, got %v", test.name, test.expectedReplicas, names)
+		}
+		if names := podNames(result.condemned); !reflect.DeepEqual(names, test.condemned) {
+			t.Errorf("%s: expected condemned %v, got %v", test.name, test.condemned, names)
+		}
+		if result.terminating != test.terminating {
+			t.Errorf("%s: expected terminating %v, got %v", test.name, test.terminating, result.terminating)
+		}
+	}
+}
+
+func TestOrdinalOperations(t *testing.T) {
+	running := func(ordinal int) testOrdinalPod {
+		return testOrdinalPod{ordinal: ordinal, phase: corev1.PodRunning, ready: true}
+	}
+	tests := []struct {
+		name           string
+		pods           []testOrdinalPod
+		replicas       int
+		parallelCreate []int
+		parallelDelete []string
+		orderedCreate  []int
+		orderedDelete  []string
+	}{
+		{
+			name:           "scale up",
+			pods:           []testOrdinalPod{running(0)},
+			replicas:       3,
+			parallelCreate: []int{1, 2},
+			orderedCreate:  []int{1},
+		},
+		{
+			name:           "waiting for a pod to be ready",
+			pods:           []testOrdinalPod{{ordinal: 0, phase: corev1.PodRunning}},
+			replicas:       2,
+			parallelCreate: []int{1},
+		},
+		{
+			name:           "terminated replica",
+			pods:           []testOrdinalPod{running(0), {ordinal: 1, phase: corev1.PodFailed}, {ordinal: 2, phase: corev1.PodSucceeded}},
+			replicas:       3,
+			parallelDelete: []string{"pod-1", "pod-2"},
+			orderedDelete:  []string{"pod-1"},
+		},
+		{
+			name:           "replica being deleted",
+			pods:           []testOrdinalPod{{ordinal: 0, phase: corev1.PodFailed, deleting: true}},
+			replicas:       2,
+			parallelCreate: []int{1},
+		},
+		{
+			name:           "scale down",
+			pods:           []testOrdinalPod{running(0), running(1), running(2)},
+			replicas:       1,
+			parallelDelete: []string{"pod-2", "pod-1"},
+			orderedDelete:  []string{"pod-2"},
+		},
+		{
+			name:           "scale down waits for the terminating pods",
+			pods:           []testOrdinalPod{running(0), running(1), {ordinal: 2, phase: corev1.PodRunning, deleting: true}},
+			replicas:       1,
+			parallelDelete: []string{"pod-1"},
+		},
+	}
+
+	for _, test := range tests {
+		ordinals := getOrdinalPods(newTestOrdinalPods(test.pods), test.replicas)
+		toCreate, toDelete := ordinals.parallelOperations()
+		if !reflect.DeepEqual(toCreate, test.parallelCreate) || !reflect.DeepEqual(podNames(toDelete), test.parallelDelete) {
+			t.Errorf("%s: expected parallel operations %v %v, got %v %v", test.name, test.parallelCreate, test.parallelDelete, toCreate, podNames(toDelete))
+		}
+		toCreate, toDelete = ordinals.orderedOperations()
+		if !reflect.DeepEqual(toCreate, test.orderedCreate) || !reflect.DeepEqual(podNames(toDelete), test.orderedDelete) {
+			t.Errorf("%s: expected ordered operations %v %v, got %v %v", test.name, test.orderedCreate, test.orderedDelete, toCreate, podNames(toDelete))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// podPlacement is the topology domain and the subset a pod of a PodSet belongs to,
+// empty if none.
+type podPlacement struct {
+	domain string
+	subset string
+}
+
+func getPodPlacement(pod *corev1.Pod) podPlacement {
+	return podPlacement{
+		domain: pod.Labels[pixiutypes.PodSetTopologyDomainLabel],
+		subset: pod.Labels[pixiutypes.PodSetSubsetLabel],
+	}
+}
+
+// partition is a group of pods of a PodSet given a share of its replicas.
+type partition struct {
+	name   string
+	weight int
+}
+
+// assignPartitions returns the partition of each of the first n pods of a PodSet. The
+// pods are spread by weight with a smooth weighted round robin, so that the first pods
+// of any count are spread as evenly as possible and the pods of an ordinal PodSet keep
+// their partition across scale operations. It returns -1 for every pod if all the
+// weights are 0.
+func assignPartitions(partitions []partition, n int) []int {
+	assigned := make([]int, n)
+	total := 0
+	for _, p := range partitions {
+		total += p.weight
+	}
+	if total <= 0 {
+		for i := range assigned {
+			assigned[i] = -1
+		}
+		return assigned
+	}
+
+	current := make([]int, len(partitions))
+	for i := range assigned {
+		best := -1
+		for j, p := range partitions {
+			current[j] += p.weight
+			if best < 0 || current[j] > current[best] {
+				best = j
+			}
+		}
+		current[best] -= total
+		assigned[i] = best
+	}
+	return assigned
+}
+
+// getPartitionTargets returns the number of pods of each partition among n pods.
+func getPartitionTargets(partitions []partition, n int) []int {
+	targets := make([]int, len(partitions))
+	for _, i := range assignPartitions(partitions, n) {
+		if i >= 0 {
+			targets[i]++
+		}
+	}
+	return targets
+}
+
+// getPartitionDeficits returns the partitions of the pods to create so that every
+// partition reaches its target, given the number of pods each one has. The creations
+// take turns across the partitions, so that the first ones are spread.
+func getPartitionDeficits(partitions []partition, targets []int, counts map[string]int) []string {
+	deficits := make([]int, len(partitions))
+	remaining := 0
+	for i, p := range partitions {
+		if deficit := targets[i] - counts[p.name]; deficit > 0 {
+			deficits[i] = deficit
+			remaining += deficit
+		}
+	}
+
+	var names []string
+	for remaining > 0 {
+		for i, p := range partitions {
+			if deficits[i] > 0 {
+				names = append(names, p.name)
+				deficits[i]--
+				remaining--
+			}
+		}
+	}
+	return names
+}
+
+// getPartitionSurpluses returns how many pods of each partition exceed its target,
+// given the number of pods each one has. The pods of unknown partitions are all in
+// surplus.
+func getPartitionSurpluses(partitions []partition, targets []int, counts map[string]int) map[string]int {
+	surpluses := make(map[string]int, len(counts))
+	for name, count := range counts {
+		surpluses[name] = count
+	}
+	for i, p := range partitions {
+		surpluses[p.name] -= targets[i]
+	}
+	return surpluses
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAssignPartitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		partitions []partition
+		n          int
+		expected   []int
+	}{
+		{name: "no pods", partitions: []partition{{name: "a", weight: 1}}, n: 0, expected: []int{}},
+		{name: "even weights", partitions: []partition{{name: "a", weight: 1}, {name: "b", weight: 1}}, n: 4, expected: []int{0, 1, 0, 1}},
+		{name: "weighted", partitions: []partition{{name: "a", weight: 2}, {name: "b", weight: 1}}, n: 3, expected: []int{0, 1, 0}},
+		{name: "weighted prefix", partitions: []partition{{name: "a", weight: 3}, {name: "b", weight: 1}}, n: 4, expected: []int{0, 0, 1, 0}},
+		{name: "zero weight", partitions: []partition{{name: "a", weight: 0}, {name: "b", weight: 1}}, n: 2, expected: []int{1, 1}},
+		{name: "all zero weights", partitions: []partition{{name: "a", weight: 0}}, n: 2, expected: []int{-1, -1}},
+		{name: "no partitions", n: 1, expected: []int{-1}},
+	}
+
+	for _, test := range tests {
+		if assigned := assignPartitions(test.partitions, test.n); !reflect.DeepEqual(assigned, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, assigned)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+const (
+	PendingTimeoutReason = "PendingTimeout"
+
+	// The reasons a pod is pending for.
+	UnschedulablePendingReason     = "Unschedulable"
+	ContainerCreatingPendingReason = "ContainerCreating"
+)
+
+// getPendingReason returns why the pod is pending, the message of the scheduler or of
+// the kubelet about it, and since when it is pending. It returns false if the pod is
+// neither unscheduled nor creating its containers.
+func getPendingReason(pod *corev1.Pod) (string, string, time.Time, bool) {
+	if pod.Status.Phase != corev1.PodPending || pod.DeletionTimestamp != nil {
+		return "", "", time.Time{}, false
+	}
+
+	_, scheduled := GetPodConditionFromList(pod.Status.Conditions, corev1.PodScheduled)
+	if scheduled == nil || scheduled.Status != corev1.ConditionTrue {
+		if scheduled == nil || scheduled.LastTransitionTime.IsZero() {
+			return UnschedulablePendingReason, "", pod.CreationTimestamp.Time, true
+		}
+		return UnschedulablePendingReason, scheduled.Message, scheduled.LastTransitionTime.Time, true
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason == ContainerCreatingPendingReason {
+			return ContainerCreatingPendingReason, waiting.Message, scheduled.LastTransitionTime.Time, true
+		}
+	}
+	return "", "", time.Time{}, false
+}
+
+func getPendingTimeout(podSet *pixiuv1alpha1.PodSet) time.Duration {
+	if podSet.Spec.PendingTimeoutSeconds == nil {
+		return 0
+	}
+	return time.Duration(*podSet.Spec.PendingTimeoutSeconds) * time.Second
+}
+
+// replacePendingPods deletes the pods pending longer than the pending timeout of the
+// PodSet, they are recreated by the next sync. It returns the replaced pods and how
+// long to wait for the replacements held back by the rate limits, if any.
+func (r *PodSetReconciler) replacePendingPods(ctx context.Context, filteredPods []*corev1.Pod, podSet *pixiuv1alpha1.PodSet) ([]pixiuv1alpha1.PodSetPendingReplacement, time.Duration, error) {
+	timeout := getPendingTimeout(podSet)
+	if timeout <= 0 {
+		return nil, 0, nil
+	}
+
+	now := metav1.Now()
+	var toDelete []*corev1.Pod
+	var replaced []pixiuv1alpha1.PodSetPendingReplacement
+	for _, pod := range filteredPods {
+		reason, message, since, ok := getPendingReason(pod)
+		if !ok || now.Sub(since) < timeout {
+			continue
+		}
+		toDelete = append(toDelete, pod)
+		replaced = append(replaced, pixiuv1alpha1.PodSetPendingReplacement{
+			PodName: pod.Name,
+			Reason:  reason,
+			Message: message,
+			Time:    now,
+		})
+	}
+	if len(toDelete) == 0 {
+		return nil, 0, nil
+	}
+
+	granted, throttle := r.throttle(podSet, len(toDelete))
+	toDelete, replaced = toDelete[:granted], replaced[:granted]
+	for i, pod := range toDelete {
+		r.Recorder.Eventf(podSet, corev1.EventTypeWarning, PendingTimeoutReason, "Replacing pod %s pending for more than %v, %s: %s",
+			pod.Name, timeout, replaced[i].Reason, replaced[i].Message)
+	}
+	r.Log.Info("Replacing pending pods", "podSet", klog.KObj(podSet), "deleting", len(toDelete))
+	if err := r.deletePods(ctx, podSet, toDelete); err != nil {
+		return nil, throttle, err
+	}
+	return replaced, throttle, nil
+}
+
+// getNextPendingTimeout returns how long until the next pending pod of the PodSet
+// reaches the pending timeout, 0 if none is pending.
+func getNextPendingTimeout(podSet *pixiuv1alpha1.PodSet, filteredPods []*corev1.Pod) time.Duration {
+	timeout := getPendingTimeout(podSet)
+	if timeout <= 0 {
+		return 0
+	}
+
+	var next time.Duration
+	for _, pod := range filteredPods {
+		_, _, since, ok := getPendingReason(pod)
+		if !ok {
+			continue
+		}
+		if remaining := timeout - time.Since(since); remaining > 0 && (next == 0 || remaining < next) {
+			next = remaining
+		}
+	}
+	return next
+}
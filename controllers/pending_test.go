@@ -0,0 +1,192 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/flowcontrol"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	"github.com/caoyingjunz/podset-operator/pkg/metrics"
+)
+
+// newTestPendingPod returns a pod of the PodSet web, pending for the given reason
+// since the given time. An empty reason returns a running pod.
+func newTestPendingPod(name, reason string, since time.Time) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              name,
+			Labels:            map[string]string{"app": "web"},
+			CreationTimestamp: metav1.NewTime(since),
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	switch reason {
+	case UnschedulablePendingReason:
+		pod.Status.Conditions = []corev1.PodCondition{{
+			Type:               corev1.PodScheduled,
+			Status:             corev1.ConditionFalse,
+			Reason:             corev1.PodReasonUnschedulable,
+			Message:            "0/3 nodes are available",
+			LastTransitionTime: metav1.NewTime(since),
+		}}
+	case ContainerCreatingPendingReason:
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(since)}}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "app",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: ContainerCreatingPendingReason, Message: "pulling image"}},
+		}}
+	default:
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(since)}}
+	}
+	return pod
+}
+
+func TestReplacePendingPods(t *testing.T) {
+	now := time.Now()
+	timeout := int32(60)
+	tests := []struct {
+		name     string
+		timeout  *int32
+		pods     []*corev1.Pod
+		replaced []string
+		next     time.Duration
+	}{
+		{
+			name: "no timeout",
+			pods: []*corev1.Pod{newTestPendingPod("a", UnschedulablePendingReason, now.Add(-time.Hour))},
+		},
+		{
+			name:    "timed out",
+			timeout: &timeout,
+			pods: []*corev1.Pod{
+				newTestPendingPod("unschedulable", UnschedulablePendingReason, now.Add(-2*time.Minute)),
+				newTestPendingPod("creating", ContainerCreatingPendingReason, now.Add(-2*time.Minute)),
+				newTestPendingPod("running", "", now.Add(-2*time.Minute)),
+			},
+			replaced: []string{"unschedulable/Unschedulable/0/3 nodes are available", "creating/ContainerCreating/pulling image"},
+		},
+		{
+			name:    "within the timeout",
+			timeout: &timeout,
+			pods: []*corev1.Pod{
+				newTestPendingPod("old", UnschedulablePendingReason, now.Add(-2*time.Minute)),
+				newTestPendingPod("new", UnschedulablePendingReason, now.Add(-30*time.Second)),
+			},
+			replaced: []string{"old/Unschedulable/0/3 nodes are available"},
+			next:     30 * time.Second,
+		},
+		{
+			name:    "pending since its creation",
+			timeout: &timeout,
+			pods: []*corev1.Pod{
+				func() *corev1.Pod {
+					pod := newTestPendingPod("unscheduled", UnschedulablePendingReason, now.Add(-2*time.Minute))
+					pod.Status.Conditions = nil
+					return pod
+				}(),
+			},
+			replaced: []string{"unscheduled/Unschedulable/"},
+		},
+	}
+
+	for _, test := range tests {
+		ps := newTestPodSet("web", 3, pixiuv1alpha1.RandomPodIdentity)
+		ps.Spec.PendingTimeoutSeconds = test.timeout
+		var objs []client.Object
+		for _, pod := range test.pods {
+			objs = append(objs, pod)
+		}
+		r := newTestReconciler(objs...)
+
+		replaced, throttle, err := r.replacePendingPods(context.TODO(), test.pods, ps)
+		if err != nil || throttle != 0 {
+			t.Errorf("%s: unexpected throttle %v, error %v", test.name, throttle, err)
+			continue
+		}
+		var got []string
+		for _, replacement := range replaced {
+			got = append(got, fmt.Sprintf("%s/%s/%s", replacement.PodName, replacement.Reason, replacement.Message))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.replaced) {
+			t.Errorf("%s: expected %v replaced, got %v", test.name, test.replaced, got)
+		}
+		if pods, _ := listTestPods(t, r); len(pods) != len(test.pods)-len(test.replaced) {
+			t.Errorf("%s: expected %d pods deleted, got %d left", test.name, len(test.replaced), len(pods))
+		}
+
+		// The pods within the timeout are checked again once they reach it.
+		next := getNextPendingTimeout(ps, test.pods)
+		if test.next == 0 && next != 0 || test.next != 0 && (next <= test.next-time.Second || next > test.next) {
+			t.Errorf("%s: expected the next timeout in %v, got %v", test.name, test.next, next)
+		}
+	}
+}
+
+func TestReconcilePendingReplacements(t *testing.T) {
+	timeout := int32(60)
+	ps := newTestPodSet("web", 2, pixiuv1alpha1.RandomPodIdentity)
+	ps.UID = "web-uid"
+	ps.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	ps.Spec.PendingTimeoutSeconds = &timeout
+	ps.Status.PendingReplacements = 3
+	ps.Status.LastPendingReplacement = &pixiuv1alpha1.PodSetPendingReplacement{PodName: "previous", Reason: UnschedulablePendingReason}
+
+	ref := metav1.NewControllerRef(ps, pixiuv1alpha1.GroupVersionKind)
+	var objs []client.Object
+	for i, reason := range []string{UnschedulablePendingReason, ContainerCreatingPendingReason} {
+		pod := newTestPendingPod(fmt.Sprintf("web-%d", i), reason, time.Now().Add(-2*time.Minute))
+		pod.OwnerReferences = []metav1.OwnerReference{*ref}
+		objs = append(objs, pod)
+	}
+	r := newTestReconciler(append(objs, ps)...)
+	r.MetricsProvider = metrics.NewMetricsPodSet(r.Client)
+	r.Backoff = flowcontrol.NewBackOff(DefaultCrashLoopBackoff, MaxCrashLoopBackoff)
+
+	key := types.NamespacedName{Namespace: "default", Name: "web"}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	podSet := &pixiuv1alpha1.PodSet{}
+	if err := r.Get(context.TODO(), key, podSet); err != nil {
+		t.Fatalf("failed to get the PodSet: %v", err)
+	}
+	// Both pods are replaced, the count adds up and the last replacement is recorded.
+	if podSet.Status.PendingReplacements != 5 {
+		t.Errorf("expected 5 pending replacements, got %d", podSet.Status.PendingReplacements)
+	}
+	if last := podSet.Status.LastPendingReplacement; last == nil || last.PodName != "web-1" || last.Reason != ContainerCreatingPendingReason {
+		t.Errorf("expected the last replacement of web-1, got %+v", last)
+	}
+	pods, _ := listTestPods(t, r)
+	for _, pod := range pods {
+		if pod.Name == "web-0" || pod.Name == "web-1" {
+			t.Errorf("expected the pending pod %s deleted", pod.Name)
+		}
+	}
+}
@@ -46,11 +46,39 @@ func (r *PodSetReconciler) mapToPods(obj client.Object) (requests []reconcile.Re
 				Namespace: podSet.Namespace, Name: podSet.Name,
 			},
 		})
+		return
 	}
 
+	// Otherwise it's an orphan, sync the PodSets which may adopt it.
+	for _, podSet := range r.getPodPodSets(obj) {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: podSet.Namespace, Name: podSet.Name,
+			},
+		})
+	}
 	return
 }
 
+// getPodPodSets returns the PodSets of the namespace of the orphan pod whose selector
+// matches the pod labels.
+func (r *PodSetReconciler) getPodPodSets(obj client.Object) []pixiuv1alpha1.PodSet {
+	podSets := &pixiuv1alpha1.PodSetList{}
+	if err := r.List(context.TODO(), podSets, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var result []pixiuv1alpha1.PodSet
+	for _, podSet := range podSets.Items {
+		selector, err := r.parsePodSelector(&podSet)
+		if err != nil || selector.Empty() || !selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		result = append(result, podSet)
+	}
+	return result
+}
+
 func (r *PodSetReconciler) parsePodSelector(ps *pixiuv1alpha1.PodSet) (labels.Selector, error) {
 	return metav1.LabelSelectorAsSelector(ps.Spec.Selector)
 }
@@ -80,10 +108,15 @@ func IsPodActive(p *v1.Pod) bool {
 // FilterActivePods returns pods that have not terminated.
 func FilterActivePods(pods []v1.Pod) []*v1.Pod {
 	var result []*v1.Pod
-	for _, p := range pods {
-		if IsPodActive(&p) {
-			result = append(result, &p)
+	for i := range pods {
+		if IsPodActive(&pods[i]) {
+			result = append(result, &pods[i])
 		}
 	}
 	return result
 }
+
+// IsPodTerminated returns true if the pod has run to completion.
+func IsPodTerminated(p *v1.Pod) bool {
+	return v1.PodSucceeded == p.Status.Phase || v1.PodFailed == p.Status.Phase
+}
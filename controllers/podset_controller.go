@@ -20,17 +20,21 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -40,6 +44,7 @@ import (
 
 	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
 	"github.com/caoyingjunz/podset-operator/pkg/metrics"
+	"github.com/caoyingjunz/podset-operator/pkg/ratelimit"
 	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
 )
 
@@ -56,16 +61,28 @@ const (
 // PodSetReconciler reconciles a PodSet object
 type PodSetReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	Log    logr.Logger
+	// APIReader reads from the API server directly, bypassing the cache.
+	APIReader client.Reader
+	Scheme    *runtime.Scheme
+	Log       logr.Logger
 
 	Recorder        record.EventRecorder
 	MetricsProvider metrics.MetricsProvider
+
+	// Governor rate limits the pod creations and deletions of all the PodSets.
+	Governor *ratelimit.Governor
+	// BurstReplicas is the burst of the PodSets which do not set spec.burst.
+	BurstReplicas int
+	// Backoff delays the replacement of the crash looping pods of each PodSet.
+	Backoff *flowcontrol.Backoff
 }
 
 //+kubebuilder:rbac:groups=pixiu.pixiu.io,resources=podsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=pixiu.pixiu.io,resources=podsets/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=pixiu.pixiu.io,resources=podsets/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
 
 // Implement reconcile.Reconciler so the controller can reconcile objects
 var _ reconcile.Reconciler = &PodSetReconciler{}
@@ -85,6 +102,8 @@ func (r *PodSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			// Req object not found, Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
 			// Return and don't requeue
+			r.Governor.Forget(req.Namespace, req.Name)
+			r.Backoff.DeleteEntry(req.String())
 			return reconcile.Result{}, nil
 		} else {
 			log.Error(err, "error requesting pod set operator")
@@ -93,26 +112,102 @@ func (r *PodSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 	}
 
+	if podSet.DeletionTimestamp == nil {
+		if err := r.syncFinalizer(ctx, podSet); err != nil {
+			log.Error(err, "error syncing finalizer")
+			return reconcile.Result{Requeue: true}, nil
+		}
+	}
+
 	labelSelector, err := r.parsePodSelector(podSet)
 	if err != nil {
 		return reconcile.Result{Requeue: true}, nil
 	}
 	allPods := &corev1.PodList{}
 	// list all pods to include the pods that don't match the rs`s selector anymore but has the stale controller ref.
-	if err = r.List(ctx, allPods, &client.ListOptions{Namespace: req.Namespace, LabelSelector: labelSelector}); err != nil {
+	if err = r.List(ctx, allPods, client.InNamespace(req.Namespace)); err != nil {
 		log.Error(err, "error list pods")
 		return reconcile.Result{Requeue: true}, nil
 	}
+	// Adopt the matching orphans and release the pods which no longer match.
+	pods, err := r.claimPods(ctx, podSet, labelSelector, allPods.Items)
+	if err != nil {
+		log.Error(err, "error claiming pods")
+		return reconcile.Result{Requeue: true}, nil
+	}
+	if podSet.DeletionTimestamp != nil {
+		// Handle the pods as requested by the deletion policy.
+		throttle, err := r.finalizePodSet(ctx, podSet, pods)
+		if err != nil {
+			log.Error(err, "error finalizing pod set")
+			return reconcile.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{RequeueAfter: throttle}, nil
+	}
+	// The errors of the pod operations besides the replicas are returned once the
+	// status is updated, so that the PodSet is requeued with backoff.
+	var errs []error
+	// Free the identity of the pods stuck terminating on unreachable nodes.
+	nextForceDeletion, err := r.forceDeletePods(ctx, pods, podSet)
+	if err != nil {
+		log.Error(err, "error force deleting pods")
+		errs = append(errs, err)
+	}
+	// Keep the terminated pods within the retention of the PodSet.
+	terminatedPods, nextPrune, err := r.pruneTerminatedPods(ctx, pods, podSet)
+	if err != nil {
+		log.Error(err, "error deleting terminated pods")
+		errs = append(errs, err)
+	}
 	// Ignore inactive pods.
-	filteredPods := FilterActivePods(allPods.Items)
+	filteredPods := FilterActivePods(pods)
+	crashLoop := getCrashLoop(pods, time.Now())
+	// Tear down the gangs which did not run in time, they are recreated on the next sync.
+	tornDown, nextGangTimeout, gangErr := r.manageGang(ctx, filteredPods, podSet)
+	if gangErr != nil {
+		log.Error(gangErr, "error managing gang")
+		errs = append(errs, gangErr)
+	}
+	if tornDown {
+		filteredPods = nil
+	}
 
 	var replicasErr error
-	if podSet.DeletionTimestamp == nil {
-		replicasErr = r.manageReplicas(ctx, filteredPods, podSet)
+	var throttle time.Duration
+	switch {
+	case tornDown:
+		// The deleted pods are replaced once they are gone.
+	case isOrdinal(podSet):
+		throttle, replicasErr = r.manageOrdinalReplicas(ctx, pods, podSet, crashLoop)
+	default:
+		throttle, replicasErr = r.manageReplicas(ctx, filteredPods, podSet, crashLoop)
+	}
+	var replaced []pixiuv1alpha1.PodSetPendingReplacement
+	if replicasErr == nil && throttle == 0 {
+		replaced, throttle, replicasErr = r.replacePendingPods(ctx, filteredPods, podSet)
+	}
+	if replicasErr == nil && throttle == 0 && len(replaced) == 0 {
+		throttle, replicasErr = r.healPods(ctx, filteredPods, podSet)
+	}
+	if replicasErr == nil && throttle == 0 {
+		throttle, replicasErr = r.rolloutPods(ctx, filteredPods, podSet)
 	}
 
 	podSet = podSet.DeepCopy()
-	newStatus := r.calculateStatus(podSet, filteredPods, replicasErr)
+	newStatus := r.calculateStatus(podSet, filteredPods, replicasErr, throttle, crashLoop)
+	setGangCondition(podSet, &newStatus, filteredPods, tornDown, gangErr)
+	if n := len(replaced); n > 0 {
+		newStatus.PendingReplacements += int32(n)
+		newStatus.LastPendingReplacement = &replaced[n-1]
+	}
+	newStatus.SucceededReplicas, newStatus.FailedReplicas = 0, 0
+	for _, pod := range terminatedPods {
+		if pod.Status.Phase == corev1.PodSucceeded {
+			newStatus.SucceededReplicas++
+		} else {
+			newStatus.FailedReplicas++
+		}
+	}
 
 	updatePS, err := r.updatePodSetStatus(podSet, newStatus)
 	if err != nil {
@@ -121,85 +216,192 @@ func (r *PodSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return reconcile.Result{RequeueAfter: time.Duration(0) * time.Second}, nil
 	}
 
+	if getCreateError(replicasErr) != nil {
+		// The rejected pods are only created once the namespace or the PodSet is fixed.
+		// An error would requeue the PodSet right away, the other errors were logged.
+		return reconcile.Result{RequeueAfter: createRetryPeriod}, nil
+	}
+	if replicasErr != nil {
+		errs = append(errs, replicasErr)
+	}
+	if len(errs) > 0 {
+		return reconcile.Result{}, utilerrors.NewAggregate(errs)
+	}
 	if replicasErr == nil &&
-		updatePS.Status.ReadyReplicas == *(updatePS.Spec.Replicas) &&
-		updatePS.Status.AvailableReplicas != *(updatePS.Spec.Replicas) {
+		updatePS.Status.ReadyReplicas == desiredReplicas(updatePS) &&
+		updatePS.Status.AvailableReplicas != desiredReplicas(updatePS) {
 		return reconcile.Result{RequeueAfter: time.Duration(0) * time.Second}, nil
 	}
+	if throttle > 0 {
+		// Pick up the throttled pod operations once the rate limits allow it.
+		return reconcile.Result{RequeueAfter: throttle}, nil
+	}
+	if backoff := r.getCreationBackoff(podSet, crashLoop); backoff > 0 {
+		// Replace the crash looping pods once the backoff expires.
+		return reconcile.Result{RequeueAfter: backoff}, nil
+	}
+	if next := getNextPendingTimeout(podSet, filteredPods); next > 0 {
+		// Replace the pending pods once they reach the pending timeout.
+		return reconcile.Result{RequeueAfter: next}, nil
+	}
+	if next := getNextNotReadyTimeout(podSet, filteredPods); next > 0 {
+		// Replace the not ready pods once they are past the health policy.
+		return reconcile.Result{RequeueAfter: next}, nil
+	}
+	if next := getNextSubsetSpillOver(podSet, filteredPods); next > 0 {
+		// Spill the pods of the unschedulable subsets over to the next ones.
+		return reconcile.Result{RequeueAfter: next}, nil
+	}
+	if nextForceDeletion > 0 {
+		// Force delete the terminating pods once their node is unreachable for long enough.
+		return reconcile.Result{RequeueAfter: nextForceDeletion}, nil
+	}
+	if nextGangTimeout > 0 {
+		// Tear the gang down once it waited past its timeout.
+		return reconcile.Result{RequeueAfter: nextGangTimeout}, nil
+	}
+	if nextPrune > 0 {
+		// Delete the terminated pods once past their retention.
+		return reconcile.Result{RequeueAfter: nextPrune}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
-func (r *PodSetReconciler) manageReplicas(ctx context.Context, filteredPods []*corev1.Pod, podSet *pixiuv1alpha1.PodSet) error {
-	diff := len(filteredPods) - int(*podSet.Spec.Replicas)
+// manageReplicas checks and updates replicas for the given PodSet. It returns how long
+// to wait before retrying the pod operations held back by the rate limits, if any.
+// The creations are backed off while the pods of the PodSet are crash looping.
+func (r *PodSetReconciler) manageReplicas(ctx context.Context, filteredPods []*corev1.Pod, podSet *pixiuv1alpha1.PodSet, crashLoop string) (time.Duration, error) {
+	// The pods of the failed nodes are not counted, so that they are replaced right away.
+	lost, err := r.getPodsOnFailedNodes(ctx, filteredPods, podSet)
+	if err != nil {
+		return 0, err
+	}
+	healthyPods := filteredPods
+	if len(lost) > 0 {
+		healthyPods = nil
+		for _, pod := range filteredPods {
+			if !lost[pod] {
+				healthyPods = append(healthyPods, pod)
+			}
+		}
+	}
+
+	diff := len(healthyPods) - int(desiredReplicas(podSet))
+	// The domains, or the subsets, under their target get new pods even when the
+	// PodSet has enough, the ones over their target are scaled down next.
+	var placements []podPlacement
+	partitioned := podSet.Spec.Topology != nil || len(podSet.Spec.Subsets) > 0
+	if podSet.Spec.Topology != nil {
+		for _, domain := range getDomainsToCreate(podSet, healthyPods) {
+			placements = append(placements, podPlacement{domain: domain})
+		}
+	} else if len(podSet.Spec.Subsets) > 0 {
+		for _, subset := range getSubsetsToCreate(podSet, healthyPods) {
+			placements = append(placements, podPlacement{subset: subset})
+		}
+	}
+	if partitioned && (len(placements) > 0 || diff < 0) {
+		diff = -len(placements)
+	}
 	if diff < 0 {
+		if r.holdCreations(podSet, crashLoop) {
+			return 0, nil
+		}
 		diff *= -1
-		if diff > pixiutypes.BurstReplicas {
-			diff = pixiutypes.BurstReplicas
+		granted, throttle := r.throttle(podSet, diff)
+		if granted == 0 {
+			return throttle, nil
 		}
-		r.Log.Info("Too few replicas", "podSet", klog.KObj(podSet), "need", *(podSet.Spec.Replicas), "creating", diff)
-		_, err := r.createPodsInBatch(diff, 1, func() error {
-			if err := r.createPod(ctx, podSet.Namespace, &podSet.Spec.Template, podSet, metav1.NewControllerRef(podSet, pixiuv1alpha1.GroupVersionKind)); err != nil {
+		diff = granted
+		r.Log.Info("Too few replicas", "podSet", klog.KObj(podSet), "need", desiredReplicas(podSet), "creating", diff, "onFailedNodes", len(lost))
+		indexes := getFreeIndexes(filteredPods, diff)
+		successes, err := r.createPodsInBatch(diff, 1, func(index int) error {
+			var placement podPlacement
+			if index < len(placements) {
+				placement = placements[index]
+			}
+			if err := r.createPod(ctx, podSet.Namespace, &podSet.Spec.Template, podSet, metav1.NewControllerRef(podSet, pixiuv1alpha1.GroupVersionKind), indexes[index], placement); err != nil {
 				return err
 			}
 			return nil
 		})
+		r.Governor.Return(podSet.Namespace, podSet.Name, diff-successes)
 
-		return err
+		return throttle, err
 
 	} else if diff > 0 {
-		if diff > pixiutypes.BurstReplicas {
-			diff = pixiutypes.BurstReplicas
+		var podToDelete []*corev1.Pod
+		switch {
+		case podSet.Spec.Topology != nil:
+			podToDelete = getPodsToDeleteInTopology(podSet, healthyPods, diff)
+		case len(podSet.Spec.Subsets) > 0:
+			podToDelete = getPodsToDeleteInSubsets(podSet, healthyPods, diff)
+		default:
+			podToDelete = getPodsToDelete(healthyPods, diff)
 		}
-		r.Log.Info("Too many replicas", "podSet", klog.KObj(podSet), "need", *(podSet.Spec.Replicas), "deleting", diff)
-		podToDelete := getPodsToDelete(filteredPods, diff)
-
-		errCh := make(chan error, diff)
-		var wg sync.WaitGroup
-		wg.Add(diff)
-		for _, pod := range podToDelete {
-			go func(targetPod *corev1.Pod) {
-				defer wg.Done()
-				if err := r.deletePod(ctx, targetPod.Namespace, targetPod.Name); err != nil {
-					if !apierrors.IsNotFound(err) {
-						errCh <- err
-					}
-				}
-			}(pod)
+		if len(podToDelete) == 0 {
+			return 0, nil
 		}
-		wg.Wait()
-
-		select {
-		case err := <-errCh:
-			if err != nil {
-				return err
-			}
-		default:
+		granted, throttle := r.throttle(podSet, len(podToDelete))
+		if granted == 0 {
+			return throttle, nil
 		}
+		podToDelete = podToDelete[:granted]
+		r.Log.Info("Too many replicas", "podSet", klog.KObj(podSet), "need", desiredReplicas(podSet), "deleting", len(podToDelete))
+
+		return throttle, r.deletePods(ctx, podSet, podToDelete)
 	}
 
-	return nil
+	return 0, nil
+}
+
+// throttle asks the governor for n pod operations of the PodSet. It returns the number
+// of granted operations and how long to wait for the others.
+func (r *PodSetReconciler) throttle(podSet *pixiuv1alpha1.PodSet, n int) (int, time.Duration) {
+	burst := r.BurstReplicas
+	if podSet.Spec.Burst != nil {
+		burst = int(*podSet.Spec.Burst)
+	}
+	if burst <= 0 {
+		burst = pixiutypes.DefaultBurstReplicas
+	}
+
+	granted, retryAfter := r.Governor.Take(podSet.Namespace, podSet.Name, burst, n)
+	if granted < n {
+		r.Log.Info("Pod operations throttled", "podSet", klog.KObj(podSet), "want", n, "granted", granted, "retryAfter", retryAfter)
+		return granted, retryAfter
+	}
+	return granted, 0
 }
 
-func (r *PodSetReconciler) createPod(ctx context.Context, namespace string, template *corev1.PodTemplateSpec, object runtime.Object, controllerRef *metav1.OwnerReference) error {
+func (r *PodSetReconciler) createPod(ctx context.Context, namespace string, template *corev1.PodTemplateSpec, object runtime.Object, controllerRef *metav1.OwnerReference, ordinal int, placement podPlacement) error {
 	if err := validateControllerRef(controllerRef); err != nil {
 		return err
 	}
-	pod, err := GetPodFromTemplate(template, object, controllerRef)
+	if ps, ok := object.(*pixiuv1alpha1.PodSet); ok && ordinal >= 0 {
+		if err := r.createPersistentVolumeClaims(ctx, ps, ordinal); err != nil {
+			return err
+		}
+	}
+	pod, err := GetPodFromTemplate(template, object, controllerRef, ordinal, placement)
 	if err != nil {
 		return err
 	}
 
-	if len(labels.Set(pod.Labels)) == 0 {
+	if len(labels.Set(template.Labels)) == 0 {
 		// return fmt.Errorf("failed to create pod, no labels")
 		// TODO: CRD 在存储 spec.template 为空
 		ps := object.(*pixiuv1alpha1.PodSet)
-		pod.Labels = ps.Spec.Selector.MatchLabels
+		for k, v := range ps.Spec.Selector.MatchLabels {
+			pod.Labels[k] = v
+		}
 	}
 
 	pod.SetNamespace(namespace)
 	if err = r.Create(ctx, pod); err != nil {
-		if apierrors.HasStatusCause(err, corev1.NamespaceTerminatingCause) {
-			r.Recorder.Eventf(object, corev1.EventTypeWarning, FailedCreatePodReason, "Error creating: %v", err)
+		err = classifyCreateError(err)
+		if cerr := getCreateError(err); cerr != nil {
+			r.Recorder.Eventf(object, corev1.EventTypeWarning, cerr.reason, "Error creating: %v", cerr.message)
 		}
 		return err
 	}
@@ -224,29 +426,74 @@ func (r *PodSetReconciler) deletePod(ctx context.Context, namespace string, name
 	return nil
 }
 
-func (r *PodSetReconciler) createPodsInBatch(count int, initialBatchSize int, fn func() error) (int, error) {
+// deletePods deletes the given pods of the PodSet in parallel, pods which are already
+// gone are ignored. The deletions were granted by the governor, those which failed are
+// given back to it.
+func (r *PodSetReconciler) deletePods(ctx context.Context, podSet *pixiuv1alpha1.PodSet, pods []*corev1.Pod) error {
+	errCh := make(chan error, len(pods))
+	var wg sync.WaitGroup
+	wg.Add(len(pods))
+	for _, pod := range pods {
+		go func(targetPod *corev1.Pod) {
+			defer wg.Done()
+			if err := r.deletePod(ctx, targetPod.Namespace, targetPod.Name); err != nil {
+				if !apierrors.IsNotFound(err) {
+					errCh <- err
+				}
+			}
+		}(pod)
+	}
+	wg.Wait()
+	r.Governor.Return(podSet.Namespace, podSet.Name, len(errCh))
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return err
+		}
+	default:
+	}
+
+	return nil
+}
+
+// createPodsInBatch calls fn count times in parallel with the index of the call,
+// it returns the number of successful calls and the first error, if any.
+func (r *PodSetReconciler) createPodsInBatch(count int, initialBatchSize int, fn func(index int) error) (int, error) {
 	errCh := make(chan error, count)
 	var wg sync.WaitGroup
 	wg.Add(count)
 	for i := 0; i < count; i++ {
-		go func() {
+		go func(index int) {
 			defer wg.Done()
-			if err := fn(); err != nil {
+			if err := fn(index); err != nil {
 				errCh <- err
 			}
-		}()
+		}(i)
 	}
 	wg.Wait()
 
-	return 0, nil
+	successes := count - len(errCh)
+	select {
+	case err := <-errCh:
+		return successes, err
+	default:
+	}
+
+	return successes, nil
 }
 
-func (r *PodSetReconciler) calculateStatus(podSet *pixiuv1alpha1.PodSet, filteredPods []*corev1.Pod, podSetErr error) pixiuv1alpha1.PodSetStatus {
+func (r *PodSetReconciler) calculateStatus(podSet *pixiuv1alpha1.PodSet, filteredPods []*corev1.Pod, podSetErr error, throttle time.Duration, crashLoop string) pixiuv1alpha1.PodSetStatus {
 	newStatus := podSet.Status
 
 	readyReplicasCount := 0
 	availableReplicasCount := 0
+	updatedReplicasCount := 0
+	rv := newRevisions(podSet)
 	for _, pod := range filteredPods {
+		if isPodUpdated(rv, pod) {
+			updatedReplicasCount++
+		}
 		// TODO: 通过 label match pods
 		if IsPodReady(pod) {
 			readyReplicasCount++
@@ -256,20 +503,35 @@ func (r *PodSetReconciler) calculateStatus(podSet *pixiuv1alpha1.PodSet, filtere
 		}
 	}
 
-	failureCond := GetCondition(podSet.Status, pixiutypes.PodSetFailure)
-	if podSetErr != nil && failureCond == nil {
-		var reason string
-		if diff := len(filteredPods) - int(*podSet.Spec.Replicas); diff < 0 {
+	// The failure condition tells the latest failure, and is cleared once the pod
+	// operations succeed.
+	if len(crashLoop) != 0 {
+		setFailureCondition(&newStatus, pixiutypes.CrashLoopingReason, crashLoop)
+	} else if cerr := getCreateError(podSetErr); cerr != nil {
+		// Tell precisely why the pods are rejected.
+		setFailureCondition(&newStatus, cerr.reason, cerr.message)
+	} else if podSetErr != nil {
+		reason := "FailedDelete"
+		if len(filteredPods) < int(desiredReplicas(podSet)) {
 			reason = "FailedCreate"
-		} else if diff > 0 {
-			reason = "FailedDelete"
 		}
-		cond := NewReplicaSetCondition(pixiutypes.PodSetFailure, corev1.ConditionTrue, reason, podSetErr.Error())
-		SetCondition(&newStatus, cond)
-	} else if podSetErr == nil && failureCond != nil {
+		setFailureCondition(&newStatus, reason, podSetErr.Error())
+	} else {
 		RemoveCondition(&newStatus, pixiutypes.PodSetFailure)
 	}
 
+	if isSuspended(podSet) {
+		SetCondition(&newStatus, NewReplicaSetCondition(pixiutypes.PodSetSuspended, corev1.ConditionTrue, pixiutypes.SuspendedReason, "PodSet is suspended and scaled to zero."))
+	} else {
+		RemoveCondition(&newStatus, pixiutypes.PodSetSuspended)
+	}
+
+	if throttle > 0 {
+		SetCondition(&newStatus, NewReplicaSetCondition(pixiutypes.PodSetThrottled, corev1.ConditionTrue, pixiutypes.RateLimitedReason, "Pod creations and deletions are held back by the rate limits."))
+	} else {
+		RemoveCondition(&newStatus, pixiutypes.PodSetThrottled)
+	}
+
 	// TODO: the default availableReplicas is 1
 	if availableReplicasCount >= 1 {
 		SetCondition(&newStatus, NewReplicaSetCondition(pixiutypes.PodSetSuccess, corev1.ConditionTrue, pixiutypes.MinimumReplicasAvailable, "PodSet has minimum availability."))
@@ -277,7 +539,15 @@ func (r *PodSetReconciler) calculateStatus(podSet *pixiuv1alpha1.PodSet, filtere
 		SetCondition(&newStatus, NewReplicaSetCondition(pixiutypes.PodSetSuccess, corev1.ConditionTrue, pixiutypes.MinimumReplicasUnavailable, "PodSet does not have minimum availability."))
 	}
 
+	newStatus.WaitingOrdinal = nil
+	if isOrdinal(podSet) && isOrderedReady(podSet) {
+		newStatus.WaitingOrdinal = getWaitingOrdinal(podSet, filteredPods)
+	}
+	newStatus.Domains = getDomainStatus(podSet, filteredPods)
+	newStatus.Subsets, newStatus.UnplacedReplicas = getSubsetStatus(podSet, filteredPods)
+
 	newStatus.Replicas = int32(len(filteredPods))
+	newStatus.UpdatedReplicas = int32(updatedReplicasCount)
 	newStatus.ReadyReplicas = int32(readyReplicasCount)
 	newStatus.AvailableReplicas = int32(availableReplicasCount)
 	return newStatus
@@ -286,19 +556,56 @@ func (r *PodSetReconciler) calculateStatus(podSet *pixiuv1alpha1.PodSet, filtere
 // SetupWithManager sets up the controller with the Manager.
 func (r *PodSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	enqueuePod := handler.EnqueueRequestsFromMapFunc(r.mapToPods)
+	enqueueNode := handler.EnqueueRequestsFromMapFunc(r.mapNodeToPodSets)
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Pod{}, podNodeNameField, indexPodNodeName); err != nil {
+		return err
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&pixiuv1alpha1.PodSet{}).
 		Watches(&source.Kind{Type: &corev1.Pod{}}, enqueuePod).
+		Watches(&source.Kind{Type: &corev1.Node{}}, enqueueNode).
+		Owns(&batchv1.Job{}).
 		Complete(r)
 }
 
+// setFailureCondition sets the failure condition of the PodSet. Unlike SetCondition,
+// the message is updated when the reason is unchanged, the transition time is kept.
+func setFailureCondition(status *pixiuv1alpha1.PodSetStatus, reason string, message string) {
+	cond := NewReplicaSetCondition(pixiutypes.PodSetFailure, corev1.ConditionTrue, reason, message)
+	for i := range status.Conditions {
+		current := &status.Conditions[i]
+		if current.Type != cond.Type {
+			continue
+		}
+		if current.Status == cond.Status && current.Reason == reason {
+			cond.LastTransitionTime = current.LastTransitionTime
+		}
+		// The conditions may be shared with the status of the cached PodSet.
+		status.Conditions = append([]pixiuv1alpha1.PodSetCondition{}, status.Conditions...)
+		status.Conditions[i] = cond
+		return
+	}
+	status.Conditions = append(status.Conditions, cond)
+}
+
 // updateReplicaSetStatus attempts to update the Status.Replicas of the given ReplicaSet, with a single GET/PUT retry.
 func (r *PodSetReconciler) updatePodSetStatus(ps *pixiuv1alpha1.PodSet, newStatus pixiuv1alpha1.PodSetStatus) (*pixiuv1alpha1.PodSet, error) {
 	if ps.Status.Replicas == newStatus.Replicas &&
+		ps.Status.UpdatedReplicas == newStatus.UpdatedReplicas &&
 		ps.Status.ReadyReplicas == newStatus.ReadyReplicas &&
 		ps.Status.AvailableReplicas == newStatus.AvailableReplicas &&
 		ps.Generation == newStatus.ObservedGeneration &&
+		ps.Status.PendingReplacements == newStatus.PendingReplacements &&
+		ps.Status.SucceededReplicas == newStatus.SucceededReplicas &&
+		ps.Status.FailedReplicas == newStatus.FailedReplicas &&
+		ps.Status.UnplacedReplicas == newStatus.UnplacedReplicas &&
+		reflect.DeepEqual(ps.Status.WaitingOrdinal, newStatus.WaitingOrdinal) &&
+		reflect.DeepEqual(ps.Status.LastPendingReplacement, newStatus.LastPendingReplacement) &&
+		reflect.DeepEqual(ps.Status.Domains, newStatus.Domains) &&
+		reflect.DeepEqual(ps.Status.Subsets, newStatus.Subsets) &&
+		reflect.DeepEqual(ps.Status.Teardown, newStatus.Teardown) &&
 		reflect.DeepEqual(ps.Status.Conditions, newStatus.Conditions) {
 		return ps, nil
 	}
@@ -311,7 +618,7 @@ func (r *PodSetReconciler) updatePodSetStatus(ps *pixiuv1alpha1.PodSet, newStatu
 
 	for i, ps := 0, ps; ; i++ {
 		klog.Infof(fmt.Sprintf("Updating status for %v: %s/%s, ", ps.Kind, ps.Namespace, ps.Name) +
-			fmt.Sprintf("replicas %d->%d (need %d), ", ps.Status.Replicas, newStatus.Replicas, *(ps.Spec.Replicas)) +
+			fmt.Sprintf("replicas %d->%d (need %d), ", ps.Status.Replicas, newStatus.Replicas, desiredReplicas(ps)) +
 			fmt.Sprintf("readyReplicas %d->%d, ", ps.Status.ReadyReplicas, newStatus.ReadyReplicas) +
 			fmt.Sprintf("availableReplicas %d->%d, ", ps.Status.AvailableReplicas, newStatus.AvailableReplicas))
 
@@ -334,6 +641,32 @@ func (r *PodSetReconciler) updatePodSetStatus(ps *pixiuv1alpha1.PodSet, newStatu
 	return ps, nil
 }
 
+// isOrdinal returns true if the pods of the PodSet have a stable ordinal identity.
+func isOrdinal(podSet *pixiuv1alpha1.PodSet) bool {
+	return podSet.Spec.PodManagement.Identity == pixiuv1alpha1.OrdinalPodIdentity
+}
+
+// isSuspended returns true if the PodSet is suspended.
+func isSuspended(podSet *pixiuv1alpha1.PodSet) bool {
+	return podSet.Spec.Suspend != nil && *podSet.Spec.Suspend
+}
+
+// desiredReplicas returns the number of pods the PodSet should be running. A suspended
+// PodSet wants no pods, its configured replicas are kept in the spec for the resume.
+func desiredReplicas(podSet *pixiuv1alpha1.PodSet) int32 {
+	if isSuspended(podSet) {
+		return 0
+	}
+	return *podSet.Spec.Replicas
+}
+
+// getPodsToDelete returns the pods to remove on scale down, the pods with the highest
+// index first so that the remaining indexes stay below the replicas.
 func getPodsToDelete(filteredPods []*corev1.Pod, diff int) []*corev1.Pod {
-	return filteredPods[:diff]
+	pods := make([]*corev1.Pod, len(filteredPods))
+	copy(pods, filteredPods)
+	sort.SliceStable(pods, func(i, j int) bool {
+		return comparePodOrdinals(pods[i], pods[j]) > 0
+	})
+	return pods[:diff]
 }
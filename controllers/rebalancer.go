@@ -0,0 +1,264 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+const (
+	RebalancePodReason       = "Rebalancing"
+	FailedRebalancePodReason = "FailedRebalance"
+)
+
+//+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+
+// Rebalancer periodically evicts the pods of the PodSets piled on a few nodes, so
+// that they are rescheduled apart. It only rebalances the PodSets with a Soft
+// anti-affinity or a topology, one pod per PodSet at a time and once all their pods
+// are running and ready. The evictions honor the pod disruption budgets.
+type Rebalancer struct {
+	client.Client
+	KubeClient kubernetes.Interface
+	Log        logr.Logger
+	Recorder   record.EventRecorder
+
+	// Interval is the period of the rebalancing passes.
+	Interval time.Duration
+	// MaxSkew is the difference of pods between the most and the least loaded nodes,
+	// or domains of the anti-affinity topology key, a PodSet tolerates.
+	MaxSkew int
+	// Limiter rate limits the evictions of all the PodSets.
+	Limiter flowcontrol.RateLimiter
+}
+
+// Start runs the rebalancing passes until the context is done.
+func (r *Rebalancer) Start(ctx context.Context) error {
+	r.Log.Info("Starting rebalancer", "interval", r.Interval, "maxSkew", r.MaxSkew)
+	wait.UntilWithContext(ctx, r.rebalance, r.Interval)
+	return nil
+}
+
+// NeedLeaderElection makes the rebalancer run on the leader only.
+func (r *Rebalancer) NeedLeaderElection() bool {
+	return true
+}
+
+func (r *Rebalancer) rebalance(ctx context.Context) {
+	podSets := &pixiuv1alpha1.PodSetList{}
+	if err := r.List(ctx, podSets); err != nil {
+		r.Log.Error(err, "error listing pod sets")
+		return
+	}
+	nodes := &corev1.NodeList{}
+	if err := r.List(ctx, nodes); err != nil {
+		r.Log.Error(err, "error listing nodes")
+		return
+	}
+
+	for i := range podSets.Items {
+		podSet := &podSets.Items[i]
+		if !needsRebalance(podSet) {
+			continue
+		}
+		if err := r.rebalancePodSet(ctx, podSet, nodes.Items); err != nil {
+			r.Log.Error(err, "error rebalancing pod set", "podSet", klog.KObj(podSet))
+		}
+	}
+}
+
+// needsRebalance returns true if the pods of the PodSet are meant to be kept apart,
+// with a Soft anti-affinity or spread across the nodes of their topology domains, and
+// the PodSet is neither paused, suspended nor deleted. The scheduler already keeps
+// apart the pods with a Hard anti-affinity.
+func needsRebalance(podSet *pixiuv1alpha1.PodSet) bool {
+	spread := podSet.Spec.AntiAffinity == pixiuv1alpha1.SoftAntiAffinity ||
+		(podSet.Spec.Topology != nil && podSet.Spec.AntiAffinity != pixiuv1alpha1.HardAntiAffinity)
+	return spread && !podSet.Spec.Paused && !isSuspended(podSet) && podSet.DeletionTimestamp == nil
+}
+
+// rebalancePodSet evicts a pod of the most loaded node, or domain, of the PodSet if
+// its skew exceeds the maximum.
+func (r *Rebalancer) rebalancePodSet(ctx context.Context, podSet *pixiuv1alpha1.PodSet, nodes []corev1.Node) error {
+	selector, err := metav1.LabelSelectorAsSelector(podSet.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	podList := &corev1.PodList{}
+	if err = r.List(ctx, podList, client.InNamespace(podSet.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return err
+	}
+	var pods []*corev1.Pod
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if metav1.IsControlledBy(pod, podSet) && IsPodActive(pod) {
+			pods = append(pods, pod)
+		}
+	}
+	// Only rebalance a settled PodSet, the evicted pod is not replaced otherwise.
+	if len(pods) != int(desiredReplicas(podSet)) {
+		return nil
+	}
+	for _, pod := range pods {
+		if !isRunningAndReady(pod) {
+			return nil
+		}
+	}
+
+	pod, skew := getWorstPlacedPod(podSet, pods, nodes)
+	if pod == nil || skew <= r.MaxSkew {
+		return nil
+	}
+	if !r.Limiter.TryAccept() {
+		return nil
+	}
+
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &pod.UID},
+		},
+	}
+	if err = r.KubeClient.CoreV1().Pods(pod.Namespace).EvictV1(ctx, eviction); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		// A disruption budget forbids the eviction for now.
+		r.Recorder.Eventf(podSet, corev1.EventTypeWarning, FailedRebalancePodReason, "Error evicting pod %s on %s, skew %d: %v", pod.Name, pod.Spec.NodeName, skew, err)
+		return nil
+	}
+	r.Recorder.Eventf(podSet, corev1.EventTypeNormal, RebalancePodReason, "Evicted pod %s on %s, skew %d exceeds %d", pod.Name, pod.Spec.NodeName, skew, r.MaxSkew)
+	r.Log.Info("Rebalanced pod", "podSet", klog.KObj(podSet), "pod", klog.KObj(pod), "skew", skew)
+	return nil
+}
+
+// getWorstPlacedPod returns the pod with the highest index of the most loaded value
+// of the anti-affinity topology key, and the skew of the PodSet. The pods of every
+// topology domain of the PodSet are balanced across the nodes of their domain.
+func getWorstPlacedPod(podSet *pixiuv1alpha1.PodSet, pods []*corev1.Pod, nodes []corev1.Node) (*corev1.Pod, int) {
+	key := getAntiAffinityTopologyKey(podSet)
+	nodesByName := make(map[string]*corev1.Node, len(nodes))
+	for i := range nodes {
+		nodesByName[nodes[i].Name] = &nodes[i]
+	}
+
+	// Group the pods by domain, then by value of the anti-affinity topology key.
+	placements := make(map[string]map[string][]*corev1.Pod)
+	for _, pod := range pods {
+		node, ok := nodesByName[pod.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		value, ok := node.Labels[key]
+		if !ok {
+			continue
+		}
+		domain := getPodDomain(pod)
+		if placements[domain] == nil {
+			placements[domain] = make(map[string][]*corev1.Pod)
+		}
+		placements[domain][value] = append(placements[domain][value], pod)
+	}
+
+	var worst []*corev1.Pod
+	var worstSkew int
+	for domain, placement := range placements {
+		// The empty values the pods could move to count as well.
+		counts := make(map[string]int)
+		for i := range nodes {
+			node := &nodes[i]
+			if value, ok := node.Labels[key]; ok && isNodeEligible(podSet, node, domain) {
+				counts[value] = 0
+			}
+		}
+		var crowded []*corev1.Pod
+		for value, placed := range placement {
+			counts[value] = len(placed)
+			if len(placed) > len(crowded) {
+				crowded = placed
+			}
+		}
+		least := len(crowded)
+		for _, count := range counts {
+			if count < least {
+				least = count
+			}
+		}
+		if skew := len(crowded) - least; skew > worstSkew {
+			worst, worstSkew = crowded, skew
+		}
+	}
+	if len(worst) == 0 {
+		return nil, 0
+	}
+
+	sort.SliceStable(worst, func(i, j int) bool {
+		return comparePodOrdinals(worst[i], worst[j]) > 0
+	})
+	return worst[0], worstSkew
+}
+
+// isNodeEligible returns true if the pods of the PodSet in the given topology domain
+// can be scheduled on the node, as far as its readiness, taints, labels and domain
+// tell.
+func isNodeEligible(podSet *pixiuv1alpha1.PodSet, node *corev1.Node, domain string) bool {
+	if node.Spec.Unschedulable || isNodeFailed(node) {
+		return false
+	}
+	if !labels.SelectorFromSet(podSet.Spec.Template.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	if podSet.Spec.Topology != nil && len(domain) != 0 && node.Labels[getTopologyKey(podSet)] != domain {
+		return false
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		if !toleratesTaint(podSet.Spec.Template.Spec.Tolerations, taint) {
+			return false
+		}
+	}
+	return true
+}
+
+func toleratesTaint(tolerations []corev1.Toleration, taint *corev1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
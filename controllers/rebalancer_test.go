@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+func TestNeedsRebalance(t *testing.T) {
+	topology := &pixiuv1alpha1.PodSetTopology{Domains: []pixiuv1alpha1.PodSetTopologyDomain{{Name: "a"}, {Name: "b"}}}
+	tests := []struct {
+		name         string
+		antiAffinity pixiuv1alpha1.AntiAffinityType
+		topology     *pixiuv1alpha1.PodSetTopology
+		paused       bool
+		expected     bool
+	}{
+		{name: "no spreading", expected: false},
+		{name: "soft anti-affinity", antiAffinity: pixiuv1alpha1.SoftAntiAffinity, expected: true},
+		{name: "hard anti-affinity", antiAffinity: pixiuv1alpha1.HardAntiAffinity, expected: false},
+		{name: "topology", topology: topology, expected: true},
+		{name: "topology with hard anti-affinity", antiAffinity: pixiuv1alpha1.HardAntiAffinity, topology: topology, expected: false},
+		{name: "paused", antiAffinity: pixiuv1alpha1.SoftAntiAffinity, paused: true, expected: false},
+	}
+
+	for _, test := range tests {
+		ps := newTestPodSet("web", 4, pixiuv1alpha1.RandomPodIdentity)
+		ps.Spec.AntiAffinity = test.antiAffinity
+		ps.Spec.Topology = test.topology
+		ps.Spec.Paused = test.paused
+		if got := needsRebalance(ps); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestGetWorstPlacedPodInTopology(t *testing.T) {
+	ps := newTestPodSet("web", 4, pixiuv1alpha1.RandomPodIdentity)
+	ps.Spec.Topology = &pixiuv1alpha1.PodSetTopology{Domains: []pixiuv1alpha1.PodSetTopologyDomain{{Name: "a"}, {Name: "b"}}}
+
+	newNode := func(name, zone string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			corev1.LabelHostname:     name,
+			corev1.LabelTopologyZone: zone,
+		}}, Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}}}
+	}
+	newPod := func(name, domain, node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{pixiutypes.PodSetTopologyDomainLabel: domain}},
+			Spec:       corev1.PodSpec{NodeName: node},
+		}
+	}
+	nodes := []corev1.Node{newNode("a1", "a"), newNode("a2", "a"), newNode("b1", "b")}
+
+	// The pods of domain b have a single node, the pods of domain a pile on a1.
+	pods := []*corev1.Pod{
+		newPod("web-0", "a", "a1"),
+		newPod("web-1", "a", "a1"),
+		newPod("web-2", "a", "a1"),
+		newPod("web-3", "b", "b1"),
+		newPod("web-4", "b", "b1"),
+	}
+	pod, skew := getWorstPlacedPod(ps, pods, nodes)
+	if pod == nil || pod.Spec.NodeName != "a1" || skew != 3 {
+		t.Errorf("expected a pod of a1 with skew 3, got %v with skew %d", pod, skew)
+	}
+}
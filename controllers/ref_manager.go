@@ -0,0 +1,146 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+// claimPods returns the pods owned by the PodSet. It adopts the orphan pods matching
+// the selector of the PodSet and releases the owned pods which no longer match it,
+// the pods controlled by others are ignored. An ordinal PodSet only adopts the pods
+// with an ordinal, the others would be deleted right away as outside its replicas.
+func (r *PodSetReconciler) claimPods(ctx context.Context, podSet *pixiuv1alpha1.PodSet, selector labels.Selector, pods []corev1.Pod) ([]corev1.Pod, error) {
+	var claimed []corev1.Pod
+	var errs []error
+	var canAdopt *bool
+
+	for i := range pods {
+		pod := &pods[i]
+		controllerRef := metav1.GetControllerOf(pod)
+		if controllerRef != nil {
+			if controllerRef.UID != podSet.UID {
+				// Owned by someone else.
+				continue
+			}
+			if selector.Matches(labels.Set(pod.Labels)) || podSet.DeletionTimestamp != nil {
+				// A PodSet being deleted keeps its pods rather than releasing them.
+				claimed = append(claimed, *pod)
+				continue
+			}
+			if err := r.releasePod(ctx, podSet, pod); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		// An empty selector would adopt all the pods of the namespace.
+		if podSet.DeletionTimestamp != nil || pod.DeletionTimestamp != nil ||
+			selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if _, ok := getPodOrdinal(pod); isOrdinal(podSet) && !ok {
+			klog.V(4).Infof("not adopting pod %s/%s without ordinal into PodSet %s", pod.Namespace, pod.Name, podSet.Name)
+			continue
+		}
+		if canAdopt == nil {
+			adopt := r.canAdoptPods(ctx, podSet)
+			canAdopt = &adopt
+		}
+		if !*canAdopt {
+			continue
+		}
+		if err := r.adoptPod(ctx, podSet, pod); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		claimed = append(claimed, *pod)
+	}
+
+	return claimed, utilerrors.NewAggregate(errs)
+}
+
+// canAdoptPods rechecks the PodSet against the API server, so that a PodSet deleted
+// since it was cached does not adopt new pods.
+func (r *PodSetReconciler) canAdoptPods(ctx context.Context, podSet *pixiuv1alpha1.PodSet) bool {
+	fresh := &pixiuv1alpha1.PodSet{}
+	if err := r.APIReader.Get(ctx, types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}, fresh); err != nil {
+		klog.V(4).Infof("failed to recheck PodSet %s/%s before adoption: %v", podSet.Namespace, podSet.Name, err)
+		return false
+	}
+	return fresh.UID == podSet.UID && fresh.DeletionTimestamp == nil
+}
+
+// adoptPod sets the PodSet as the controller of the pod. The patch fails if the pod
+// was replaced by another pod of the same name.
+func (r *PodSetReconciler) adoptPod(ctx context.Context, podSet *pixiuv1alpha1.PodSet, pod *corev1.Pod) error {
+	controllerRef := metav1.NewControllerRef(podSet, pixiuv1alpha1.GroupVersionKind)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []metav1.OwnerReference{*controllerRef},
+			"uid":             pod.UID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err = r.Patch(ctx, pod, client.RawPatch(types.StrategicMergePatchType, patch)); err != nil {
+		return fmt.Errorf("failed to adopt pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+
+	r.Log.Info("Adopted orphan pod", "podSet", klog.KObj(podSet), "pod", klog.KObj(pod))
+	return nil
+}
+
+// releasePod removes the PodSet owner reference from the pod, pods which are already
+// gone are ignored.
+func (r *PodSetReconciler) releasePod(ctx context.Context, podSet *pixiuv1alpha1.PodSet, pod *corev1.Pod) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []map[string]interface{}{
+				{"$patch": "delete", "uid": podSet.UID},
+			},
+			"uid": pod.UID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err = r.Patch(ctx, pod, client.RawPatch(types.StrategicMergePatchType, patch)); err != nil {
+		// The pod is gone or was replaced, nothing to release.
+		if apierrors.IsNotFound(err) || apierrors.IsInvalid(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to release pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+
+	r.Log.Info("Released pod", "podSet", klog.KObj(podSet), "pod", klog.KObj(pod))
+	return nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// patchRecorder records the patches of the pods by name.
+type patchRecorder struct {
+	client.Client
+	patches map[string][]byte
+}
+
+func (c *patchRecorder) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	c.patches[obj.GetName()] = data
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestClaimPods(t *testing.T) {
+	ps := newTestPodSet("web", 3, pixiuv1alpha1.RandomPodIdentity)
+	ps.UID = "web"
+	ps.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	selector := labels.SelectorFromSet(labels.Set{"app": "web"})
+
+	newPod := func(name, app string, owner *metav1.OwnerReference) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			UID:       types.UID(name),
+			Labels:    map[string]string{"app": app},
+		}}
+		if owner != nil {
+			pod.OwnerReferences = []metav1.OwnerReference{*owner}
+		}
+		return pod
+	}
+	owned := metav1.NewControllerRef(ps, pixiuv1alpha1.GroupVersionKind)
+	other := &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "other", UID: "other", Controller: owned.Controller}
+	recreated := ps.DeepCopy()
+	recreated.UID = "recreated"
+	deleting := ps.DeepCopy()
+	deleting.DeletionTimestamp = &metav1.Time{}
+	ordinal := ps.DeepCopy()
+	ordinal.Spec.PodManagement.Identity = pixiuv1alpha1.OrdinalPodIdentity
+	withOrdinal := func(pod *corev1.Pod, ordinal string) *corev1.Pod {
+		pod.Labels[pixiutypes.PodSetOrdinalLabel] = ordinal
+		return pod
+	}
+
+	tests := []struct {
+		name     string
+		podSet   *pixiuv1alpha1.PodSet
+		fresh    *pixiuv1alpha1.PodSet
+		pods     []*corev1.Pod
+		claimed  []string
+		adopted  []string
+		released []string
+	}{
+		{
+			name:    "adopt orphans and skip the pods of other controllers",
+			podSet:  ps,
+			fresh:   ps,
+			pods:    []*corev1.Pod{newPod("web-a", "web", owned), newPod("web-b", "web", nil), newPod("web-c", "web", other), newPod("db-a", "db", nil)},
+			claimed: []string{"web-a", "web-b"},
+			adopted: []string{"web-b"},
+		},
+		{
+			name:     "release the pods no longer matching",
+			podSet:   ps,
+			fresh:    ps,
+			pods:     []*corev1.Pod{newPod("web-a", "web", owned), newPod("web-b", "db", owned)},
+			claimed:  []string{"web-a"},
+			released: []string{"web-b"},
+		},
+		{
+			name:    "no adoption once the PodSet was deleted",
+			podSet:  ps,
+			pods:    []*corev1.Pod{newPod("web-a", "web", owned), newPod("web-b", "web", nil)},
+			claimed: []string{"web-a"},
+		},
+		{
+			name:    "no adoption once the PodSet was recreated",
+			podSet:  ps,
+			fresh:   recreated,
+			pods:    []*corev1.Pod{newPod("web-b", "web", nil)},
+			claimed: nil,
+		},
+		{
+			name:    "a PodSet being deleted keeps its pods and adopts none",
+			podSet:  deleting,
+			fresh:   deleting,
+			pods:    []*corev1.Pod{newPod("web-a", "db", owned), newPod("web-b", "web", nil)},
+			claimed: []string{"web-a"},
+		},
+		{
+			name:   "an ordinal PodSet adopts the orphans with an ordinal only",
+			podSet: ordinal,
+			fresh:  ordinal,
+			pods: []*corev1.Pod{
+				withOrdinal(newPod("web-0", "web", nil), "0"), newPod("web-a", "web", nil),
+				withOrdinal(newPod("web-b", "web", nil), "b"), withOrdinal(newPod("web-c", "web", owned), "c"),
+			},
+			claimed: []string{"web-0", "web-c"},
+			adopted: []string{"web-0"},
+		},
+	}
+
+	for _, test := range tests {
+		objs := []client.Object{}
+		var pods []corev1.Pod
+		for _, pod := range test.pods {
+			objs = append(objs, pod)
+			pods = append(pods, *pod)
+		}
+		r := newTestReconciler(objs...)
+		// The PodSet is only known to the API server, not to the cache.
+		r.APIReader = newTestReconciler().Client
+		if test.fresh != nil {
+			r.APIReader = newTestReconciler(test.fresh.DeepCopy()).Client
+		}
+		recorder := &patchRecorder{Client: r.Client, patches: map[string][]byte{}}
+		r.Client = recorder
+
+		claimed, err := r.claimPods(context.TODO(), test.podSet, selector, pods)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		var names []string
+		for _, pod := range claimed {
+			names = append(names, pod.Name)
+		}
+		if !reflect.DeepEqual(names, test.claimed) {
+			t.Errorf("%s: expected claimed pods %v, got %v", test.name, test.claimed, names)
+		}
+
+		var patched []string
+		for name := range recorder.patches {
+			patched = append(patched, name)
+		}
+		sort.Strings(patched)
+		expected := append(append([]string(nil), test.adopted...), test.released...)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(patched, expected) {
+			t.Errorf("%s: expected patched pods %v, got %v", test.name, expected, patched)
+		}
+
+		for _, name := range expected {
+			// The patches are conditioned on the UID of the pod, so that a pod recreated
+			// under the same name is left alone.
+			patch := struct {
+				Metadata struct {
+					UID types.UID `json:"uid"`
+				} `json:"metadata"`
+			}{}
+			if err := json.Unmarshal(recorder.patches[name], &patch); err != nil || patch.Metadata.UID != types.UID(name) {
+				t.Errorf("%s: expected the patch of pod %s to hold its uid, got %s", test.name, name, recorder.patches[name])
+			}
+
+			pod := &corev1.Pod{}
+			if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: name}, pod); err != nil {
+				t.Errorf("%s: failed to get pod %s: %v", test.name, name, err)
+				continue
+			}
+			ref := metav1.GetControllerOf(pod)
+			isAdopted := ref != nil && ref.UID == ps.UID
+			if wantAdopted := sets.NewString(test.adopted...).Has(name); isAdopted != wantAdopted {
+				t.Errorf("%s: expected pod %s controlled by the PodSet %v, got %v", test.name, name, wantAdopted, pod.OwnerReferences)
+			}
+		}
+	}
+}
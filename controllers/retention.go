@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+// getTerminationTime returns when the last container of the terminated pod finished,
+// or when the pod started if none did.
+func getTerminationTime(pod *corev1.Pod) time.Time {
+	var finished time.Time
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.FinishedAt.After(finished) {
+			finished = terminated.FinishedAt.Time
+		}
+	}
+	if finished.IsZero() && pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	if finished.IsZero() {
+		return pod.CreationTimestamp.Time
+	}
+	return finished
+}
+
+// pruneTerminatedPods deletes the terminated pods of the PodSet beyond its retention,
+// except the pods which failed recently and count towards a crash loop. It returns the
+// terminated pods kept, and how long until the next one expires or the deletions held
+// back by the rate limits can be retried, if any.
+func (r *PodSetReconciler) pruneTerminatedPods(ctx context.Context, pods []corev1.Pod, podSet *pixiuv1alpha1.PodSet) ([]*corev1.Pod, time.Duration, error) {
+	var terminated []*corev1.Pod
+	for i := range pods {
+		if IsPodTerminated(&pods[i]) && pods[i].DeletionTimestamp == nil {
+			terminated = append(terminated, &pods[i])
+		}
+	}
+	retention := podSet.Spec.TerminatedPodRetention
+	if retention == nil || len(terminated) == 0 {
+		return terminated, 0, nil
+	}
+
+	// The most recently terminated pods first.
+	sort.SliceStable(terminated, func(i, j int) bool {
+		return getTerminationTime(terminated[i]).After(getTerminationTime(terminated[j]))
+	})
+
+	now := time.Now()
+	var kept, toDelete []*corev1.Pod
+	var next time.Duration
+	for _, pod := range terminated {
+		if _, ok := getRecentFailure(pod, now); ok {
+			kept = append(kept, pod)
+			continue
+		}
+		if retention.MaxCount != nil && len(kept) >= int(*retention.MaxCount) {
+			toDelete = append(toDelete, pod)
+			continue
+		}
+		if retention.MaxAgeSeconds != nil {
+			remaining := time.Duration(*retention.MaxAgeSeconds)*time.Second - now.Sub(getTerminationTime(pod))
+			if remaining <= 0 {
+				toDelete = append(toDelete, pod)
+				continue
+			}
+			if next == 0 || remaining < next {
+				next = remaining
+			}
+		}
+		kept = append(kept, pod)
+	}
+	if len(toDelete) == 0 {
+		return kept, next, nil
+	}
+
+	granted, throttle := r.throttle(podSet, len(toDelete))
+	if throttle > 0 && (next == 0 || throttle < next) {
+		next = throttle
+	}
+	// The pods held back are kept until the next sync.
+	kept = append(kept, toDelete[granted:]...)
+	toDelete = toDelete[:granted]
+	if len(toDelete) == 0 {
+		return kept, next, nil
+	}
+
+	r.Log.Info("Deleting terminated pods", "podSet", klog.KObj(podSet), "deleting", len(toDelete), "kept", len(kept))
+	if err := r.deletePods(ctx, podSet, toDelete); err != nil {
+		return terminated, next, err
+	}
+	return kept, next, nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+func TestPruneTerminatedPods(t *testing.T) {
+	now := time.Now()
+	// newPod returns a pod of the PodSet web whose container exited with the code the
+	// given duration ago, or a running pod if the duration is 0.
+	newPod := func(name string, exitCode int32, finished time.Duration) corev1.Pod {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: map[string]string{"app": "web"}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		if finished == 0 {
+			return pod
+		}
+		pod.Status.Phase = corev1.PodSucceeded
+		if exitCode != 0 {
+			pod.Status.Phase = corev1.PodFailed
+		}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "app",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, FinishedAt: metav1.NewTime(now.Add(-finished))}},
+		}}
+		return pod
+	}
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	tests := []struct {
+		name      string
+		retention *pixiuv1alpha1.PodSetTerminatedPodRetention
+		pods      []corev1.Pod
+		kept      []string
+		deleted   []string
+		next      time.Duration
+	}{
+		{
+			name: "no retention",
+			pods: []corev1.Pod{newPod("running", 0, 0), newPod("done-1h", 0, time.Hour), newPod("done-2h", 0, 2*time.Hour)},
+			kept: []string{"done-1h", "done-2h"},
+		},
+		{
+			name:      "most recently terminated kept",
+			retention: &pixiuv1alpha1.PodSetTerminatedPodRetention{MaxCount: int32Ptr(2)},
+			pods: []corev1.Pod{
+				newPod("done-3h", 0, 3*time.Hour), newPod("done-1h", 0, time.Hour), newPod("running", 0, 0),
+				newPod("done-4h", 0, 4*time.Hour), newPod("done-2h", 0, 2*time.Hour),
+			},
+			kept:    []string{"done-1h", "done-2h"},
+			deleted: []string{"done-3h", "done-4h"},
+		},
+		{
+			name:      "recent failures kept",
+			retention: &pixiuv1alpha1.PodSetTerminatedPodRetention{MaxCount: int32Ptr(1)},
+			pods: []corev1.Pod{
+				newPod("failed-1h", 1, time.Hour), newPod("failed-5m", 1, 5*time.Minute),
+				newPod("failed-2m", 1, 2*time.Minute), newPod("done-1m", 0, time.Minute),
+			},
+			kept:    []string{"done-1m", "failed-2m", "failed-5m"},
+			deleted: []string{"failed-1h"},
+		},
+		{
+			name:      "expired pods",
+			retention: &pixiuv1alpha1.PodSetTerminatedPodRetention{MaxAgeSeconds: int32Ptr(1800)},
+			pods:      []corev1.Pod{newPod("done-1h", 0, time.Hour), newPod("done-10m", 0, 10*time.Minute), newPod("done-20m", 0, 20*time.Minute)},
+			kept:      []string{"done-10m", "done-20m"},
+			deleted:   []string{"done-1h"},
+			next:      10 * time.Minute,
+		},
+		{
+			name:      "count and age",
+			retention: &pixiuv1alpha1.PodSetTerminatedPodRetention{MaxCount: int32Ptr(1), MaxAgeSeconds: int32Ptr(1800)},
+			pods:      []corev1.Pod{newPod("done-1h", 0, time.Hour), newPod("done-10m", 0, 10*time.Minute), newPod("done-5m", 0, 5*time.Minute)},
+			kept:      []string{"done-5m"},
+			deleted:   []string{"done-10m", "done-1h"},
+			next:      25 * time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		ps := newTestPodSet("web", 1, pixiuv1alpha1.RandomPodIdentity)
+		ps.Spec.TerminatedPodRetention = test.retention
+		var objs []client.Object
+		for i := range test.pods {
+			objs = append(objs, &test.pods[i])
+		}
+		r := newTestReconciler(objs...)
+		_, before := listTestPods(t, r)
+
+		kept, next, err := r.pruneTerminatedPods(context.TODO(), test.pods, ps)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		var keptNames []string
+		for _, pod := range kept {
+			keptNames = append(keptNames, pod.Name)
+		}
+		sort.Strings(keptNames)
+		if fmt.Sprint(keptNames) != fmt.Sprint(test.kept) {
+			t.Errorf("%s: expected %v kept, got %v", test.name, test.kept, keptNames)
+		}
+		_, after := listTestPods(t, r)
+		left := make(map[string]bool)
+		for _, name := range after {
+			left[name] = true
+		}
+		var deleted []string
+		for _, name := range before {
+			if !left[name] {
+				deleted = append(deleted, name)
+			}
+		}
+		if fmt.Sprint(deleted) != fmt.Sprint(test.deleted) {
+			t.Errorf("%s: expected %v deleted, got %v", test.name, test.deleted, deleted)
+		}
+		if test.next == 0 && next != 0 || test.next != 0 && (next <= test.next-time.Second || next > test.next) {
+			t.Errorf("%s: expected the next expiry in %v, got %v", test.name, test.next, next)
+		}
+	}
+}
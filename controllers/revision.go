@@ -0,0 +1,249 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/klog/v2"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// overrideSelects returns true if the override applies to the pod of the given ordinal.
+func overrideSelects(override *pixiuv1alpha1.PodSetOverride, ordinal int, replicas int) bool {
+	if override.Ordinals != nil {
+		end := replicas - 1
+		if override.Ordinals.End != nil {
+			end = int(*override.Ordinals.End)
+		}
+		if ordinal >= int(override.Ordinals.Start) && ordinal <= end {
+			return true
+		}
+	}
+	for _, index := range override.Indexes {
+		i := int(index)
+		if i < 0 {
+			i += replicas
+		}
+		if i == ordinal {
+			return true
+		}
+	}
+	return false
+}
+
+// getPodTemplate returns the template of the pod of the given ordinal and placement,
+// that is the PodSet template patched by the overrides selecting the pod and by its
+// subset, pinned to its topology domain and kept apart from the other pods as
+// requested by the anti-affinity of the PodSet. Pods without ordinal don't get the
+// overrides, and pods without domain are not pinned.
+func getPodTemplate(podSet *pixiuv1alpha1.PodSet, ordinal int, placement podPlacement) (*corev1.PodTemplateSpec, error) {
+	template := podSet.Spec.Template.DeepCopy()
+	subset := getSubset(podSet, placement.subset)
+	if (ordinal >= 0 && len(podSet.Spec.Overrides) > 0) || (subset != nil && len(subset.Patch.Raw) > 0) {
+		original, err := json.Marshal(template)
+		if err != nil {
+			return nil, err
+		}
+		patched := original
+		for i := range podSet.Spec.Overrides {
+			override := &podSet.Spec.Overrides[i]
+			if ordinal < 0 || !overrideSelects(override, ordinal, int(*podSet.Spec.Replicas)) {
+				continue
+			}
+			if patched, err = strategicpatch.StrategicMergePatch(patched, override.Patch.Raw, corev1.PodTemplateSpec{}); err != nil {
+				return nil, fmt.Errorf("failed to apply override %d: %v", i, err)
+			}
+		}
+		if subset != nil && len(subset.Patch.Raw) > 0 {
+			if patched, err = strategicpatch.StrategicMergePatch(patched, subset.Patch.Raw, corev1.PodTemplateSpec{}); err != nil {
+				return nil, fmt.Errorf("failed to apply subset %s: %v", subset.Name, err)
+			}
+		}
+
+		template = &corev1.PodTemplateSpec{}
+		if err = json.Unmarshal(patched, template); err != nil {
+			return nil, err
+		}
+	}
+	if podSet.Spec.Topology != nil && len(placement.domain) != 0 {
+		pinToDomain(template, getTopologyKey(podSet), placement.domain)
+	}
+	addAntiAffinity(podSet, template)
+	return template, nil
+}
+
+// computeRevision returns a hash of the pod template, used to tell the outdated pods.
+func computeRevision(template *corev1.PodTemplateSpec) string {
+	data, _ := json.Marshal(template)
+	hasher := fnv.New32a()
+	hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// getSelectingOverrides returns the indexes of the overrides selecting the pod of the
+// given ordinal, in the order they are applied.
+func getSelectingOverrides(podSet *pixiuv1alpha1.PodSet, ordinal int) []int {
+	if ordinal < 0 {
+		return nil
+	}
+	var selecting []int
+	for i := range podSet.Spec.Overrides {
+		if overrideSelects(&podSet.Spec.Overrides[i], ordinal, int(*podSet.Spec.Replicas)) {
+			selecting = append(selecting, i)
+		}
+	}
+	return selecting
+}
+
+// getPatchRevision returns a hash of the overrides selecting the pod of the given
+// ordinal and of the patch of its subset. Unlike the revision, it is kept when the
+// base template changes.
+func getPatchRevision(podSet *pixiuv1alpha1.PodSet, ordinal int, subset string) string {
+	hasher := fnv.New32a()
+	for _, i := range getSelectingOverrides(podSet, ordinal) {
+		hasher.Write(podSet.Spec.Overrides[i].Patch.Raw)
+		hasher.Write([]byte{0})
+	}
+	if s := getSubset(podSet, subset); s != nil {
+		hasher.Write(s.Patch.Raw)
+	}
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// getDesiredPlacement returns the placement the pod should have. The pods of an
+// ordinal PodSet move to the domain of their ordinal, the others are moved by scaling
+// the domains and the subsets.
+func getDesiredPlacement(podSet *pixiuv1alpha1.PodSet, pod *corev1.Pod) (int, podPlacement) {
+	ordinal, ok := getPodOrdinal(pod)
+	if !ok {
+		ordinal = -1
+	}
+	placement := getPodPlacement(pod)
+	if isOrdinal(podSet) {
+		placement.domain = getOrdinalDomain(podSet, ordinal)
+	}
+	return ordinal, placement
+}
+
+// revisions builds the revisions of the pods of a PodSet, the template of the pods
+// sharing the same overrides and placement is built once.
+type revisions struct {
+	podSet *pixiuv1alpha1.PodSet
+	cache  map[string]string
+}
+
+func newRevisions(podSet *pixiuv1alpha1.PodSet) *revisions {
+	return &revisions{podSet: podSet, cache: make(map[string]string)}
+}
+
+// get returns the revision the pod of the given ordinal and placement should run.
+func (rv *revisions) get(ordinal int, placement podPlacement) (string, error) {
+	key := fmt.Sprintf("%v/%s/%s", getSelectingOverrides(rv.podSet, ordinal), placement.subset, placement.domain)
+	if revision, ok := rv.cache[key]; ok {
+		return revision, nil
+	}
+	template, err := getPodTemplate(rv.podSet, ordinal, placement)
+	if err != nil {
+		return "", err
+	}
+	revision := computeRevision(template)
+	rv.cache[key] = revision
+	return revision, nil
+}
+
+// isPodUpdated returns true if the pod runs the revision it should and, depending on
+// the reshard policy, was created for the current replicas. Pods without a revision,
+// such as the adopted ones, are considered up to date.
+func isPodUpdated(rv *revisions, pod *corev1.Pod) bool {
+	if isPodResharded(rv.podSet, pod) {
+		return false
+	}
+	revision, ok := pod.Labels[pixiutypes.PodSetRevisionLabel]
+	if !ok {
+		return true
+	}
+	desired, err := rv.get(getDesiredPlacement(rv.podSet, pod))
+	if err != nil {
+		// The template cannot be built, keep the pod until it can.
+		return true
+	}
+	return revision == desired
+}
+
+// isPodRolled returns true if the pod has to be replaced, because its overrides or its
+// subset patch changed, its ordinal moved to another domain or, depending on the
+// reshard policy, the replicas changed. Like for a ReplicaSet, a change of the base
+// template is only picked up by the new pods.
+func isPodRolled(podSet *pixiuv1alpha1.PodSet, pod *corev1.Pod) bool {
+	if isPodResharded(podSet, pod) {
+		return true
+	}
+	ordinal, placement := getDesiredPlacement(podSet, pod)
+	if placement.domain != getPodPlacement(pod).domain {
+		return true
+	}
+	revision, ok := pod.Labels[pixiutypes.PodSetPatchRevisionLabel]
+	return ok && revision != getPatchRevision(podSet, ordinal, placement.subset)
+}
+
+// rolloutPods replaces the rolled pods of the PodSet one at a time, once all its pods
+// are running and ready. The replacement is created by the next sync.
+func (r *PodSetReconciler) rolloutPods(ctx context.Context, filteredPods []*corev1.Pod, podSet *pixiuv1alpha1.PodSet) (time.Duration, error) {
+	if podSet.Spec.Paused || len(filteredPods) != int(desiredReplicas(podSet)) {
+		return 0, nil
+	}
+
+	var outdated *corev1.Pod
+	for _, pod := range filteredPods {
+		if !isRunningAndReady(pod) {
+			return 0, nil
+		}
+		if !isPodRolled(podSet, pod) {
+			continue
+		}
+		// Ordinal PodSets are rolled from the highest ordinal
+		if outdated == nil || comparePodOrdinals(pod, outdated) > 0 {
+			outdated = pod
+		}
+	}
+	if outdated == nil {
+		return 0, nil
+	}
+
+	granted, throttle := r.throttle(podSet, 1)
+	if granted == 0 {
+		return throttle, nil
+	}
+	r.Log.Info("Rolling outdated pod", "podSet", klog.KObj(podSet), "pod", klog.KObj(outdated))
+	return 0, r.deletePods(ctx, podSet, []*corev1.Pod{outdated})
+}
+
+func comparePodOrdinals(a, b *corev1.Pod) int {
+	ordinalA, _ := getPodOrdinal(a)
+	ordinalB, _ := getPodOrdinal(b)
+	return ordinalA - ordinalB
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+func TestIsPodRolled(t *testing.T) {
+	newPodSet := func() *pixiuv1alpha1.PodSet {
+		ps := newTestPodSet("db", 3, pixiuv1alpha1.OrdinalPodIdentity)
+		ps.Spec.Overrides = []pixiuv1alpha1.PodSetOverride{{
+			Indexes: []int32{0},
+			Patch:   runtime.RawExtension{Raw: []byte(`{"spec":{"containers":[{"name":"app","image":"nginx:primary"}]}}`)},
+		}}
+		return ps
+	}
+
+	tests := []struct {
+		name   string
+		update func(ps *pixiuv1alpha1.PodSet)
+		rolled []bool
+		// updated tells which pods run the current revision.
+		updated []bool
+	}{
+		{
+			name:    "unchanged PodSet",
+			update:  func(ps *pixiuv1alpha1.PodSet) {},
+			rolled:  []bool{false, false, false},
+			updated: []bool{true, true, true},
+		},
+		{
+			name: "changed base template",
+			update: func(ps *pixiuv1alpha1.PodSet) {
+				ps.Spec.Template.Spec.Containers[0].Image = "nginx:new"
+			},
+			rolled: []bool{false, false, false},
+			// The image of the first pod is overridden.
+			updated: []bool{true, false, false},
+		},
+		{
+			name: "changed override",
+			update: func(ps *pixiuv1alpha1.PodSet) {
+				ps.Spec.Overrides[0].Patch.Raw = []byte(`{"spec":{"containers":[{"name":"app","image":"nginx:other"}]}}`)
+			},
+			rolled:  []bool{true, false, false},
+			updated: []bool{false, true, true},
+		},
+		{
+			name: "override selecting another pod",
+			update: func(ps *pixiuv1alpha1.PodSet) {
+				ps.Spec.Overrides[0].Indexes = []int32{-1}
+			},
+			rolled:  []bool{true, false, true},
+			updated: []bool{false, true, false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ps := newPodSet()
+			pods := make([]*corev1.Pod, 0, 3)
+			for ordinal := 0; ordinal < 3; ordinal++ {
+				pod, err := GetPodFromTemplate(&ps.Spec.Template, ps, nil, ordinal, podPlacement{})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				pods = append(pods, pod)
+			}
+
+			test.update(ps)
+			rv := newRevisions(ps)
+			for i, pod := range pods {
+				if rolled := isPodRolled(ps, pod); rolled != test.rolled[i] {
+					t.Errorf("pod %s: expected rolled %v, got %v", pod.Name, test.rolled[i], rolled)
+				}
+				if updated := isPodUpdated(rv, pod); updated != test.updated[i] {
+					t.Errorf("pod %s: expected updated %v, got %v", pod.Name, test.updated[i], updated)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// getFreeIndexes returns the count lowest indexes not used by the given pods.
+func getFreeIndexes(pods []*corev1.Pod, count int) []int {
+	used := make(map[int]bool, len(pods))
+	for _, pod := range pods {
+		if index, ok := getPodOrdinal(pod); ok {
+			used[index] = true
+		}
+	}
+
+	indexes := make([]int, 0, count)
+	for index := 0; len(indexes) < count; index++ {
+		if !used[index] {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// isPodResharded returns true if the pod has to be replaced to see the current
+// replicas of its PodSet.
+func isPodResharded(podSet *pixiuv1alpha1.PodSet, pod *corev1.Pod) bool {
+	if podSet.Spec.ReshardPolicy != pixiuv1alpha1.RestartAllReshardPolicy {
+		return false
+	}
+	replicas, ok := pod.Annotations[pixiutypes.PodSetReplicasAnnotation]
+	return ok && replicas != strconv.Itoa(int(*podSet.Spec.Replicas))
+}
+
+// injectPodSetEnv exposes the index of the pod, the replicas and the name of its
+// PodSet to every container through downward API references. The variables already
+// defined by a container are left untouched.
+func injectPodSetEnv(pod *corev1.Pod) {
+	envs := []corev1.EnvVar{
+		downwardAPIEnv(pixiutypes.PodSetIndexEnv, fmt.Sprintf("metadata.labels['%s']", pixiutypes.PodSetOrdinalLabel)),
+		downwardAPIEnv(pixiutypes.PodSetReplicasEnv, fmt.Sprintf("metadata.annotations['%s']", pixiutypes.PodSetReplicasAnnotation)),
+		downwardAPIEnv(pixiutypes.PodSetNameEnv, fmt.Sprintf("metadata.labels['%s']", pixiutypes.PodSetNameLabel)),
+	}
+
+	for i := range pod.Spec.InitContainers {
+		injectEnv(&pod.Spec.InitContainers[i], envs)
+	}
+	for i := range pod.Spec.Containers {
+		injectEnv(&pod.Spec.Containers[i], envs)
+	}
+}
+
+func injectEnv(container *corev1.Container, envs []corev1.EnvVar) {
+	defined := make(map[string]bool, len(container.Env))
+	for _, env := range container.Env {
+		defined[env.Name] = true
+	}
+	for _, env := range envs {
+		if !defined[env.Name] {
+			container.Env = append(container.Env, env)
+		}
+	}
+}
+
+func downwardAPIEnv(name string, fieldPath string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{
+				APIVersion: "v1",
+				FieldPath:  fieldPath,
+			},
+		},
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+// defaultSubsetUnschedulableTimeout is how long the pods of a subset may stay
+// unschedulable before the next subsets get its pods, unless the PodSet has a
+// pending timeout.
+const defaultSubsetUnschedulableTimeout = 5 * time.Minute
+
+// getSubset returns the subset of the PodSet with the given name, nil if none.
+func getSubset(podSet *pixiuv1alpha1.PodSet, name string) *pixiuv1alpha1.PodSetSubset {
+	if len(name) == 0 {
+		return nil
+	}
+	for i := range podSet.Spec.Subsets {
+		if podSet.Spec.Subsets[i].Name == name {
+			return &podSet.Spec.Subsets[i]
+		}
+	}
+	return nil
+}
+
+func getSubsetUnschedulableTimeout(podSet *pixiuv1alpha1.PodSet) time.Duration {
+	if timeout := getPendingTimeout(podSet); timeout > 0 {
+		return timeout
+	}
+	return defaultSubsetUnschedulableTimeout
+}
+
+func getSubsetPartitions(podSet *pixiuv1alpha1.PodSet) []partition {
+	partitions := make([]partition, 0, len(podSet.Spec.Subsets))
+	for _, subset := range podSet.Spec.Subsets {
+		partitions = append(partitions, partition{name: subset.Name, weight: 1})
+	}
+	return partitions
+}
+
+func getSubsetCounts(pods []*corev1.Pod) map[string]int {
+	counts := make(map[string]int)
+	for _, pod := range pods {
+		counts[getPodPlacement(pod).subset]++
+	}
+	return counts
+}
+
+func isPodUnschedulable(pod *corev1.Pod) (time.Time, bool) {
+	reason, _, since, ok := getPendingReason(pod)
+	return since, ok && reason == UnschedulablePendingReason
+}
+
+// getSubsetTargets returns the number of pods each subset of the PodSet should have,
+// and whether each subset is unschedulable. The subsets get their share of the
+// replicas first, then the pods above the maximum of a subset, or above the scheduled
+// pods of an unschedulable subset, spill over to the next subsets. It also returns
+// the pods spilling over the last subset, which no subset can take.
+func getSubsetTargets(podSet *pixiuv1alpha1.PodSet, pods []*corev1.Pod) ([]int, []bool, int) {
+	subsets := podSet.Spec.Subsets
+	desired := int(desiredReplicas(podSet))
+	targets := make([]int, len(subsets))
+	remaining := desired
+	var flexible []int
+	for i, subset := range subsets {
+		if subset.Replicas == nil {
+			flexible = append(flexible, i)
+			continue
+		}
+		replicas, err := intstr.GetScaledValueFromIntOrPercent(subset.Replicas, desired, false)
+		if err != nil || replicas < 0 {
+			replicas = 0
+		}
+		if replicas > remaining {
+			replicas = remaining
+		}
+		targets[i] = replicas
+		remaining -= replicas
+	}
+	if len(flexible) > 0 {
+		partitions := make([]partition, len(flexible))
+		for j := range partitions {
+			partitions[j] = partition{weight: 1}
+		}
+		for j, target := range getPartitionTargets(partitions, remaining) {
+			targets[flexible[j]] += target
+		}
+	} else if len(subsets) > 0 {
+		targets[len(subsets)-1] += remaining
+	}
+
+	now := time.Now()
+	timeout := getSubsetUnschedulableTimeout(podSet)
+	scheduled := make(map[string]int)
+	stuck := make(map[string]bool)
+	for _, pod := range pods {
+		subset := getPodPlacement(pod).subset
+		since, unschedulable := isPodUnschedulable(pod)
+		if !unschedulable {
+			scheduled[subset]++
+		} else if now.Sub(since) >= timeout {
+			stuck[subset] = true
+		}
+	}
+
+	unschedulable := make([]bool, len(subsets))
+	spill := 0
+	for i, subset := range subsets {
+		target := targets[i] + spill
+		limit := -1
+		if subset.MaxReplicas != nil {
+			limit = int(*subset.MaxReplicas)
+		}
+		if stuck[subset.Name] {
+			unschedulable[i] = true
+			if limit < 0 || scheduled[subset.Name] < limit {
+				limit = scheduled[subset.Name]
+			}
+		}
+		spill = 0
+		if limit >= 0 && target > limit {
+			spill = target - limit
+			target = limit
+		}
+		targets[i] = target
+	}
+	return targets, unschedulable, spill
+}
+
+// getSubsetsToCreate returns the subsets of the pods to create so that every subset of
+// the PodSet reaches its target.
+func getSubsetsToCreate(podSet *pixiuv1alpha1.PodSet, pods []*corev1.Pod) []string {
+	targets, _, _ := getSubsetTargets(podSet, pods)
+	return getPartitionDeficits(getSubsetPartitions(podSet), targets, getSubsetCounts(pods))
+}
+
+// getPodsToDeleteInSubsets returns the pods to remove from the subsets over their
+// target, the not ready pods first. The ready pods are only removed while the PodSet
+// has more ready pods than replicas, so that the pods which spilled over are kept until
+// the pods of their subset are ready.
+func getPodsToDeleteInSubsets(podSet *pixiuv1alpha1.PodSet, pods []*corev1.Pod, diff int) []*corev1.Pod {
+	targets, _, _ := getSubsetTargets(podSet, pods)
+	surpluses := getPartitionSurpluses(getSubsetPartitions(podSet), targets, getSubsetCounts(pods))
+
+	candidates := make([]*corev1.Pod, len(pods))
+	copy(candidates, pods)
+	readyBudget := -int(desiredReplicas(podSet))
+	for _, pod := range pods {
+		if IsPodReady(pod) {
+			readyBudget++
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if readyI, readyJ := IsPodReady(candidates[i]), IsPodReady(candidates[j]); readyI != readyJ {
+			return !readyI
+		}
+		return comparePodOrdinals(candidates[i], candidates[j]) > 0
+	})
+
+	var toDelete []*corev1.Pod
+	for _, pod := range candidates {
+		if len(toDelete) == diff {
+			break
+		}
+		subset := getPodPlacement(pod).subset
+		if surpluses[subset] <= 0 {
+			continue
+		}
+		if IsPodReady(pod) {
+			if readyBudget <= 0 {
+				continue
+			}
+			readyBudget--
+		}
+		surpluses[subset]--
+		toDelete = append(toDelete, pod)
+	}
+	return toDelete
+}
+
+// getSubsetStatus returns the pods of each subset of the PodSet, and the number of
+// replicas no subset can take.
+func getSubsetStatus(podSet *pixiuv1alpha1.PodSet, filteredPods []*corev1.Pod) ([]pixiuv1alpha1.PodSetSubsetStatus, int32) {
+	if len(podSet.Spec.Subsets) == 0 {
+		return nil, 0
+	}
+	targets, unschedulable, unplaced := getSubsetTargets(podSet, filteredPods)
+	subsets := make([]pixiuv1alpha1.PodSetSubsetStatus, len(podSet.Spec.Subsets))
+	index := make(map[string]int, len(podSet.Spec.Subsets))
+	for i, subset := range podSet.Spec.Subsets {
+		subsets[i] = pixiuv1alpha1.PodSetSubsetStatus{
+			Name:          subset.Name,
+			Target:        int32(targets[i]),
+			Unschedulable: unschedulable[i],
+		}
+		index[subset.Name] = i
+	}
+	for _, pod := range filteredPods {
+		i, ok := index[getPodPlacement(pod).subset]
+		if !ok {
+			continue
+		}
+		subsets[i].Replicas++
+		if IsPodReady(pod) {
+			subsets[i].ReadyReplicas++
+		}
+	}
+	return subsets, int32(unplaced)
+}
+
+// getNextSubsetSpillOver returns how long until the next unschedulable pod of the
+// PodSet makes its subset spill over, 0 if none is unschedulable.
+func getNextSubsetSpillOver(podSet *pixiuv1alpha1.PodSet, filteredPods []*corev1.Pod) time.Duration {
+	if len(podSet.Spec.Subsets) == 0 {
+		return 0
+	}
+	timeout := getSubsetUnschedulableTimeout(podSet)
+
+	var next time.Duration
+	for _, pod := range filteredPods {
+		since, ok := isPodUnschedulable(pod)
+		if !ok {
+			continue
+		}
+		if remaining := timeout - time.Since(since); remaining > 0 && (next == 0 || remaining < next) {
+			next = remaining
+		}
+	}
+	return next
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+func newTestSubsetPod(subset string, phase corev1.PodPhase, age time.Duration) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:            map[string]string{pixiutypes.PodSetSubsetLabel: subset},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestGetSubsetTargets(t *testing.T) {
+	maxReplicas := func(n int32) *int32 { return &n }
+	tests := []struct {
+		name          string
+		replicas      int32
+		subsets       []pixiuv1alpha1.PodSetSubset
+		pods          []*corev1.Pod
+		targets       []int
+		unschedulable []bool
+		unplaced      int
+	}{
+		{
+			name:          "even shares",
+			replicas:      5,
+			subsets:       []pixiuv1alpha1.PodSetSubset{{Name: "a"}, {Name: "b"}},
+			targets:       []int{3, 2},
+			unschedulable: []bool{false, false},
+		},
+		{
+			name:     "fixed and flexible shares",
+			replicas: 5,
+			subsets: []pixiuv1alpha1.PodSetSubset{
+				{Name: "a", Replicas: intOrStringPtr(intstr.FromInt(2))},
+				{Name: "b"},
+			},
+			targets:       []int{2, 3},
+			unschedulable: []bool{false, false},
+		},
+		{
+			name:     "the last subset takes the rest of the fixed shares",
+			replicas: 4,
+			subsets: []pixiuv1alpha1.PodSetSubset{
+				{Name: "a", Replicas: intOrStringPtr(intstr.FromString("50%"))},
+				{Name: "b", Replicas: intOrStringPtr(intstr.FromInt(1))},
+			},
+			targets:       []int{2, 2},
+			unschedulable: []bool{false, false},
+		},
+		{
+			name:     "spill over the maximum",
+			replicas: 6,
+			subsets: []pixiuv1alpha1.PodSetSubset{
+				{Name: "a", MaxReplicas: maxReplicas(2)},
+				{Name: "b"},
+			},
+			targets:       []int{2, 4},
+			unschedulable: []bool{false, false},
+		},
+		{
+			name:     "spill over the last subset",
+			replicas: 6,
+			subsets: []pixiuv1alpha1.PodSetSubset{
+				{Name: "a", MaxReplicas: maxReplicas(2)},
+				{Name: "b", MaxReplicas: maxReplicas(2)},
+			},
+			targets:       []int{2, 2},
+			unschedulable: []bool{false, false},
+			unplaced:      2,
+		},
+		{
+			name:     "spill over an unschedulable subset",
+			replicas: 4,
+			subsets:  []pixiuv1alpha1.PodSetSubset{{Name: "a"}, {Name: "b"}},
+			pods: []*corev1.Pod{
+				newTestSubsetPod("a", corev1.PodRunning, time.Hour),
+				newTestSubsetPod("a", corev1.PodPending, time.Hour),
+				newTestSubsetPod("b", corev1.PodPending, time.Second),
+			},
+			targets:       []int{1, 3},
+			unschedulable: []bool{true, false},
+		},
+	}
+
+	for _, test := range tests {
+		podSet := newTestPodSet("web", test.replicas, pixiuv1alpha1.RandomPodIdentity)
+		podSet.Spec.Subsets = test.subsets
+		targets, unschedulable, unplaced := getSubsetTargets(podSet, test.pods)
+		if !reflect.DeepEqual(targets, test.targets) {
+			t.Errorf("%s: expected targets %v, got %v", test.name, test.targets, targets)
+		}
+		if !reflect.DeepEqual(unschedulable, test.unschedulable) {
+			t.Errorf("%s: expected unschedulable %v, got %v", test.name, test.unschedulable, unschedulable)
+		}
+		if unplaced != test.unplaced {
+			t.Errorf("%s: expected %d unplaced, got %d", test.name, test.unplaced, unplaced)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog/v2"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+const (
+	SuccessfulCreateJobReason = "SuccessfulCreateJob"
+	FailedPreDeleteHookReason = "FailedPreDeleteHook"
+)
+
+// getPreDeleteHookName returns the name of the pre-delete hook Job of the PodSet.
+func getPreDeleteHookName(podSet *pixiuv1alpha1.PodSet) string {
+	return fmt.Sprintf("%s-pre-delete", podSet.Name)
+}
+
+// getTeardownMaxUnavailable returns the maximum number of unavailable pods during the
+// teardown of the PodSet, at least 1 so that the teardown makes progress.
+func getTeardownMaxUnavailable(podSet *pixiuv1alpha1.PodSet) int {
+	maxUnavailable := intstr.FromInt(1)
+	if podSet.Spec.Teardown.MaxUnavailable != nil {
+		maxUnavailable = *podSet.Spec.Teardown.MaxUnavailable
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, int(*podSet.Spec.Replicas), false)
+	if err != nil || value < 1 {
+		return 1
+	}
+	return value
+}
+
+// teardownPods runs the pre-delete hook of the deleted PodSet, then drains its pods
+// in batches. It returns true once all the pods are gone, and how long to wait
+// before resuming a throttled teardown.
+func (r *PodSetReconciler) teardownPods(ctx context.Context, podSet *pixiuv1alpha1.PodSet, pods []corev1.Pod) (bool, time.Duration, error) {
+	// The hook is done once the pods are drained, even if its Job is gone since.
+	var hook pixiuv1alpha1.PreDeleteHookPhase
+	if podSet.Status.Teardown != nil {
+		hook = podSet.Status.Teardown.PreDeleteHook
+	}
+	cond := GetCondition(podSet.Status, pixiutypes.PodSetTerminating)
+	if podSet.Spec.Teardown.PreDeleteHook != nil && (cond == nil || cond.Reason != pixiutypes.TearingDownReason) {
+		var err error
+		if hook, err = r.runPreDeleteHook(ctx, podSet); err != nil {
+			return false, 0, err
+		}
+		if hook == pixiuv1alpha1.PreDeleteHookRunning {
+			message := fmt.Sprintf("Waiting for the pre-delete hook job %s to finish.", getPreDeleteHookName(podSet))
+			return false, 0, r.updateTeardownStatus(podSet, pods, hook, pixiutypes.RunningPreDeleteHookReason, message, 0)
+		}
+	}
+	if len(pods) == 0 {
+		return true, 0, nil
+	}
+
+	throttle, err := r.drainPods(ctx, podSet, pods)
+	if err != nil {
+		return false, 0, err
+	}
+	message := fmt.Sprintf("Tearing down the pods, at most %d unavailable at once.", getTeardownMaxUnavailable(podSet))
+	return false, throttle, r.updateTeardownStatus(podSet, pods, hook, pixiutypes.TearingDownReason, message, throttle)
+}
+
+// runPreDeleteHook makes sure the pre-delete hook Job of the PodSet is created, it
+// returns the phase of the Job.
+func (r *PodSetReconciler) runPreDeleteHook(ctx context.Context, podSet *pixiuv1alpha1.PodSet) (pixiuv1alpha1.PreDeleteHookPhase, error) {
+	name := getPreDeleteHookName(podSet)
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: podSet.Namespace, Name: name}, job)
+	if apierrors.IsNotFound(err) {
+		hook := podSet.Spec.Teardown.PreDeleteHook
+		job = &batchv1.Job{
+			ObjectMeta: *hook.ObjectMeta.DeepCopy(),
+			Spec:       *hook.Spec.DeepCopy(),
+		}
+		job.Name = name
+		job.Namespace = podSet.Namespace
+		if job.Labels == nil {
+			job.Labels = make(map[string]string)
+		}
+		job.Labels[pixiutypes.PodSetNameLabel] = podSet.Name
+		job.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(podSet, pixiuv1alpha1.GroupVersionKind)}
+		if err = r.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+			return "", fmt.Errorf("failed to create pre-delete hook job %s/%s: %v", job.Namespace, name, err)
+		}
+		r.Recorder.Eventf(podSet, corev1.EventTypeNormal, SuccessfulCreateJobReason, "Created pre-delete hook job: %v", name)
+		return pixiuv1alpha1.PreDeleteHookRunning, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get pre-delete hook job %s/%s: %v", podSet.Namespace, name, err)
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return pixiuv1alpha1.PreDeleteHookSucceeded, nil
+		case batchv1.JobFailed:
+			r.Recorder.Eventf(podSet, corev1.EventTypeWarning, FailedPreDeleteHookReason, "Pre-delete hook job %s failed: %v", name, c.Message)
+			return pixiuv1alpha1.PreDeleteHookFailed, nil
+		}
+	}
+	return pixiuv1alpha1.PreDeleteHookRunning, nil
+}
+
+// drainPods deletes the pods of the deleted PodSet in batches of its maximum
+// unavailable pods, a batch is deleted once the pods of the previous one are gone.
+// The pods which are not running and ready are deleted first, and the available pods
+// only while the unavailable pods stay within the maximum. It returns how long to
+// wait for the deletions held back by the rate limits, if any.
+func (r *PodSetReconciler) drainPods(ctx context.Context, podSet *pixiuv1alpha1.PodSet, pods []corev1.Pod) (time.Duration, error) {
+	var toDelete []*corev1.Pod
+	var available []*corev1.Pod
+	terminating := 0
+	for i := range pods {
+		pod := &pods[i]
+		switch {
+		case pod.DeletionTimestamp != nil:
+			terminating++
+		case isRunningAndReady(pod):
+			available = append(available, pod)
+		default:
+			toDelete = append(toDelete, pod)
+		}
+	}
+	batch := getTeardownMaxUnavailable(podSet) - terminating
+	if batch <= 0 {
+		return 0, nil
+	}
+	// The not ready pods stay unavailable until deleted, the available pods are only
+	// deleted within the unavailable pods left.
+	budget := batch - len(toDelete)
+	if len(toDelete) > batch {
+		toDelete = toDelete[:batch]
+	}
+	if budget > len(available) {
+		budget = len(available)
+	}
+	if budget > 0 {
+		toDelete = append(toDelete, getPodsToDelete(available, budget)...)
+	}
+	if len(toDelete) == 0 {
+		return 0, nil
+	}
+
+	granted, throttle := r.throttle(podSet, len(toDelete))
+	if granted == 0 {
+		return throttle, nil
+	}
+	toDelete = toDelete[:granted]
+	r.Log.Info("Tearing down pods", "podSet", klog.KObj(podSet), "remaining", len(pods), "deleting", len(toDelete))
+	return throttle, r.deletePods(ctx, podSet, toDelete)
+}
+
+// updateTeardownStatus reports the progress of the teardown in the PodSet status.
+func (r *PodSetReconciler) updateTeardownStatus(podSet *pixiuv1alpha1.PodSet, pods []corev1.Pod, hook pixiuv1alpha1.PreDeleteHookPhase, reason string, message string, throttle time.Duration) error {
+	newStatus := r.calculateStatus(podSet, FilterActivePods(pods), nil, throttle, "")
+	newStatus.Teardown = getTeardownStatus(podSet, pods, hook)
+	SetCondition(&newStatus, NewReplicaSetCondition(pixiutypes.PodSetTerminating, corev1.ConditionTrue, reason, message))
+	_, err := r.updatePodSetStatus(podSet, newStatus)
+	return err
+}
+
+// getTeardownStatus counts the pods drained by the teardown of the PodSet and the
+// pods it still has to delete.
+func getTeardownStatus(podSet *pixiuv1alpha1.PodSet, pods []corev1.Pod, hook pixiuv1alpha1.PreDeleteHookPhase) *pixiuv1alpha1.PodSetTeardownStatus {
+	status := &pixiuv1alpha1.PodSetTeardownStatus{
+		PreDeleteHook: hook,
+		Replicas:      int32(len(pods)),
+	}
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil {
+			status.RemainingReplicas++
+		}
+	}
+	// The pods deleted since the teardown started are no longer listed.
+	if previous := podSet.Status.Teardown; previous != nil && previous.Replicas > status.Replicas {
+		status.Replicas = previous.Replicas
+	}
+	status.DrainedReplicas = status.Replicas - status.RemainingReplicas
+	return status
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// newTestTeardownPods returns ready, not ready and terminating pods of the PodSet web,
+// named after their state and labeled with their index as ordinal.
+func newTestTeardownPods(ready, notReady, terminating int) []client.Object {
+	var pods []client.Object
+	add := func(state string, n int) {
+		for i := 0; i < n; i++ {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: fmt.Sprintf("%s-%d", state, i), Labels: map[string]string{
+					"app":                         "web",
+					pixiutypes.PodSetOrdinalLabel: strconv.Itoa(i),
+				}},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning},
+			}
+			switch state {
+			case "ready":
+				pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+			case "terminating":
+				now := metav1.Now()
+				pod.DeletionTimestamp = &now
+				pod.Finalizers = []string{"example.com/wait"}
+			}
+			pods = append(pods, pod)
+		}
+	}
+	add("ready", ready)
+	add("notready", notReady)
+	add("terminating", terminating)
+	return pods
+}
+
+// listTestPods returns the names of the pods left, and of the pods being deleted.
+func listTestPods(t *testing.T, r *PodSetReconciler) ([]corev1.Pod, []string) {
+	pods := &corev1.PodList{}
+	if err := r.List(context.TODO(), pods); err != nil {
+		t.Fatalf("failed to list pods: %v", err)
+	}
+	var names []string
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	sort.Strings(names)
+	return pods.Items, names
+}
+
+func TestDrainPods(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxUnavailable *intstr.IntOrString
+		ready          int
+		notReady       int
+		terminating    int
+		deleted        []string
+	}{
+		{name: "one pod at a time", ready: 4, deleted: []string{"ready-3"}},
+		{name: "batch of a percentage", maxUnavailable: intOrStringPtr(intstr.FromString("50%")), ready: 4, deleted: []string{"ready-2", "ready-3"}},
+		{name: "not ready pods first", maxUnavailable: intOrStringPtr(intstr.FromInt(2)), ready: 2, notReady: 1, deleted: []string{"notready-0", "ready-1"}},
+		{name: "not ready pods in batches", maxUnavailable: intOrStringPtr(intstr.FromInt(2)), ready: 1, notReady: 3, deleted: []string{"notready-0", "notready-1"}},
+		{name: "waiting for the previous batch", maxUnavailable: intOrStringPtr(intstr.FromInt(2)), ready: 2, notReady: 1, terminating: 1, deleted: []string{"notready-0"}},
+		{name: "previous batch terminating", ready: 3, terminating: 1},
+	}
+
+	for _, test := range tests {
+		ps := newTestPodSet("web", 4, pixiuv1alpha1.RandomPodIdentity)
+		ps.Spec.Teardown = &pixiuv1alpha1.PodSetTeardown{MaxUnavailable: test.maxUnavailable}
+		r := newTestReconciler(newTestTeardownPods(test.ready, test.notReady, test.terminating)...)
+		pods, before := listTestPods(t, r)
+
+		if _, err := r.drainPods(context.TODO(), ps, pods); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		_, after := listTestPods(t, r)
+		left := make(map[string]bool)
+		for _, name := range after {
+			left[name] = true
+		}
+		var deleted []string
+		for _, name := range before {
+			if !left[name] {
+				deleted = append(deleted, name)
+			}
+		}
+		if fmt.Sprint(deleted) != fmt.Sprint(test.deleted) {
+			t.Errorf("%s: expected %v deleted, got %v", test.name, test.deleted, deleted)
+		}
+	}
+}
+
+func TestTeardownPreDeleteHook(t *testing.T) {
+	for _, jobCondition := range []batchv1.JobConditionType{batchv1.JobComplete, batchv1.JobFailed} {
+		now := metav1.Now()
+		ps := newTestPodSet("web", 2, pixiuv1alpha1.RandomPodIdentity)
+		ps.DeletionTimestamp = &now
+		ps.Finalizers = []string{pixiutypes.PodSetFinalizer}
+		ps.Spec.Teardown = &pixiuv1alpha1.PodSetTeardown{PreDeleteHook: &batchv1.JobTemplateSpec{
+			Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				RestartPolicy: corev1.RestartPolicyNever,
+				Containers:    []corev1.Container{{Name: "hook", Image: "busybox"}},
+			}}},
+		}}
+		r := newTestReconciler(append(newTestTeardownPods(2, 0, 0), ps)...)
+		podSet := &pixiuv1alpha1.PodSet{}
+		if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "web"}, podSet); err != nil {
+			t.Fatalf("failed to get the PodSet: %v", err)
+		}
+		expectStatus := func(step string, hook pixiuv1alpha1.PreDeleteHookPhase, reason string) {
+			cond := GetCondition(podSet.Status, pixiutypes.PodSetTerminating)
+			if podSet.Status.Teardown == nil || podSet.Status.Teardown.PreDeleteHook != hook || cond == nil || cond.Reason != reason {
+				t.Errorf("%s, %s: expected hook %s and reason %s, got %+v and %+v", jobCondition, step, hook, reason, podSet.Status.Teardown, cond)
+			}
+		}
+
+		// The hook Job is created, the pods wait for it.
+		pods, _ := listTestPods(t, r)
+		if done, _, err := r.teardownPods(context.TODO(), podSet, pods); done || err != nil {
+			t.Fatalf("%s: expected the teardown to wait for the hook, got done %v, error %v", jobCondition, done, err)
+		}
+		job := &batchv1.Job{}
+		if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "web-pre-delete"}, job); err != nil {
+			t.Fatalf("%s: expected the hook job created, got %v", jobCondition, err)
+		}
+		if ref := metav1.GetControllerOf(job); ref == nil || ref.Name != "web" || job.Labels[pixiutypes.PodSetNameLabel] != "web" {
+			t.Errorf("%s: expected the hook job owned by the PodSet, got %v", jobCondition, job.ObjectMeta)
+		}
+		expectStatus("hook running", pixiuv1alpha1.PreDeleteHookRunning, pixiutypes.RunningPreDeleteHookReason)
+		if _, names := listTestPods(t, r); len(names) != 2 {
+			t.Errorf("%s: expected no pod deleted while the hook runs, got %v", jobCondition, names)
+		}
+
+		// Once the Job finished, successfully or not, the pods are drained.
+		job.Status.Conditions = []batchv1.JobCondition{{Type: jobCondition, Status: corev1.ConditionTrue}}
+		if err := r.Status().Update(context.TODO(), job); err != nil {
+			t.Fatalf("failed to update the hook job: %v", err)
+		}
+		hook := pixiuv1alpha1.PreDeleteHookSucceeded
+		if jobCondition == batchv1.JobFailed {
+			hook = pixiuv1alpha1.PreDeleteHookFailed
+		}
+		pods, _ = listTestPods(t, r)
+		if done, _, err := r.teardownPods(context.TODO(), podSet, pods); done || err != nil {
+			t.Fatalf("%s: expected the teardown to drain the pods, got done %v, error %v", jobCondition, done, err)
+		}
+		expectStatus("draining", hook, pixiutypes.TearingDownReason)
+		if _, names := listTestPods(t, r); len(names) != 1 {
+			t.Errorf("%s: expected one pod deleted, got %v", jobCondition, names)
+		}
+
+		// The hook is not run again while the pods are drained.
+		pods, _ = listTestPods(t, r)
+		if done, _, err := r.teardownPods(context.TODO(), podSet, pods); done || err != nil {
+			t.Fatalf("%s: expected the teardown to drain the last pod, got done %v, error %v", jobCondition, done, err)
+		}
+		expectStatus("drained", hook, pixiutypes.TearingDownReason)
+		if done, _, err := r.teardownPods(context.TODO(), podSet, nil); !done || err != nil {
+			t.Errorf("%s: expected the teardown done, got done %v, error %v", jobCondition, done, err)
+		}
+	}
+}
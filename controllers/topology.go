@@ -0,0 +1,201 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+func getTopologyKey(podSet *pixiuv1alpha1.PodSet) string {
+	if len(podSet.Spec.Topology.TopologyKey) == 0 {
+		return corev1.LabelTopologyZone
+	}
+	return podSet.Spec.Topology.TopologyKey
+}
+
+// getAntiAffinityTopologyKey returns the topology key the pods of the PodSet are kept
+// apart on, the nodes by default.
+func getAntiAffinityTopologyKey(podSet *pixiuv1alpha1.PodSet) string {
+	if len(podSet.Spec.AntiAffinityTopologyKey) == 0 {
+		return corev1.LabelHostname
+	}
+	return podSet.Spec.AntiAffinityTopologyKey
+}
+
+// getDomainPartitions returns the domains of the topology of the PodSet, weighted.
+func getDomainPartitions(podSet *pixiuv1alpha1.PodSet) []partition {
+	partitions := make([]partition, 0, len(podSet.Spec.Topology.Domains))
+	for _, domain := range podSet.Spec.Topology.Domains {
+		weight := 1
+		if domain.Weight != nil {
+			weight = int(*domain.Weight)
+		}
+		partitions = append(partitions, partition{name: domain.Name, weight: weight})
+	}
+	return partitions
+}
+
+// getOrdinalDomain returns the domain of the pod of the given ordinal, empty if the
+// PodSet has no topology.
+func getOrdinalDomain(podSet *pixiuv1alpha1.PodSet, ordinal int) string {
+	if podSet.Spec.Topology == nil || ordinal < 0 {
+		return ""
+	}
+	partitions := getDomainPartitions(podSet)
+	if i := assignPartitions(partitions, ordinal+1)[ordinal]; i >= 0 {
+		return partitions[i].name
+	}
+	return ""
+}
+
+func getPodDomain(pod *corev1.Pod) string {
+	return pod.Labels[pixiutypes.PodSetTopologyDomainLabel]
+}
+
+// getDomainCounts returns the number of pods of each domain.
+func getDomainCounts(pods []*corev1.Pod) map[string]int {
+	counts := make(map[string]int)
+	for _, pod := range pods {
+		counts[getPodDomain(pod)]++
+	}
+	return counts
+}
+
+// pinToDomain requires the pods of the template to run on the nodes of the domain, on
+// top of the node affinity they already have.
+func pinToDomain(template *corev1.PodTemplateSpec, topologyKey string, domain string) {
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      topologyKey,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{domain},
+	}
+
+	spec := &template.Spec
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	required := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil {
+		required = &corev1.NodeSelector{}
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = required
+	}
+	// The terms are ORed, the domain is required by all of them.
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	for i := range required.NodeSelectorTerms {
+		required.NodeSelectorTerms[i].MatchExpressions = append(required.NodeSelectorTerms[i].MatchExpressions, requirement)
+	}
+}
+
+// addAntiAffinity keeps the pods of the template apart from the other pods of the
+// PodSet, on top of the affinity they already have.
+func addAntiAffinity(podSet *pixiuv1alpha1.PodSet, template *corev1.PodTemplateSpec) {
+	if podSet.Spec.AntiAffinity != pixiuv1alpha1.SoftAntiAffinity && podSet.Spec.AntiAffinity != pixiuv1alpha1.HardAntiAffinity {
+		return
+	}
+	term := corev1.PodAffinityTerm{
+		LabelSelector: podSet.Spec.Selector.DeepCopy(),
+		TopologyKey:   getAntiAffinityTopologyKey(podSet),
+	}
+
+	spec := &template.Spec
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.PodAntiAffinity == nil {
+		spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	antiAffinity := spec.Affinity.PodAntiAffinity
+	if podSet.Spec.AntiAffinity == pixiuv1alpha1.HardAntiAffinity {
+		antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+	} else {
+		antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, corev1.WeightedPodAffinityTerm{
+			Weight:          100,
+			PodAffinityTerm: term,
+		})
+	}
+}
+
+// getDomainsToCreate returns the domains of the pods to create so that every domain
+// of the topology of the PodSet reaches its share of the replicas. The extra pods of
+// the other domains are removed once the replacements exist.
+func getDomainsToCreate(podSet *pixiuv1alpha1.PodSet, pods []*corev1.Pod) []string {
+	partitions := getDomainPartitions(podSet)
+	targets := getPartitionTargets(partitions, int(desiredReplicas(podSet)))
+	return getPartitionDeficits(partitions, targets, getDomainCounts(pods))
+}
+
+// getPodsToDeleteInTopology returns the pods to remove on scale down, taken from the
+// domains over their share of the replicas, the pods with the highest index first.
+func getPodsToDeleteInTopology(podSet *pixiuv1alpha1.PodSet, pods []*corev1.Pod, diff int) []*corev1.Pod {
+	partitions := getDomainPartitions(podSet)
+	targets := getPartitionTargets(partitions, int(desiredReplicas(podSet)))
+	surpluses := getPartitionSurpluses(partitions, targets, getDomainCounts(pods))
+
+	candidates := make([]*corev1.Pod, len(pods))
+	copy(candidates, pods)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return comparePodOrdinals(candidates[i], candidates[j]) > 0
+	})
+
+	var toDelete []*corev1.Pod
+	for _, pod := range candidates {
+		if len(toDelete) == diff {
+			break
+		}
+		if domain := getPodDomain(pod); surpluses[domain] > 0 {
+			surpluses[domain]--
+			toDelete = append(toDelete, pod)
+		}
+	}
+	return toDelete
+}
+
+// getDomainStatus returns the pods of each domain of the topology of the PodSet.
+func getDomainStatus(podSet *pixiuv1alpha1.PodSet, filteredPods []*corev1.Pod) []pixiuv1alpha1.PodSetDomainStatus {
+	if podSet.Spec.Topology == nil {
+		return nil
+	}
+	partitions := getDomainPartitions(podSet)
+	targets := getPartitionTargets(partitions, int(desiredReplicas(podSet)))
+	domains := make([]pixiuv1alpha1.PodSetDomainStatus, len(partitions))
+	index := make(map[string]int, len(partitions))
+	for i, p := range partitions {
+		domains[i] = pixiuv1alpha1.PodSetDomainStatus{Name: p.name, Target: int32(targets[i])}
+		index[p.name] = i
+	}
+	for _, pod := range filteredPods {
+		i, ok := index[getPodDomain(pod)]
+		if !ok {
+			continue
+		}
+		domains[i].Replicas++
+		if IsPodReady(pod) {
+			domains[i].ReadyReplicas++
+		}
+	}
+	return domains
+}
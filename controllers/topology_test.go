@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+)
+
+func TestAddAntiAffinity(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	nodeAffinity := &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+		NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+			{Key: "disktype", Operator: corev1.NodeSelectorOpIn, Values: []string{"ssd"}},
+		}}},
+	}}
+	cacheTerm := corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cache"}},
+		TopologyKey:   corev1.LabelTopologyZone,
+	}
+	hostTerm := corev1.PodAffinityTerm{LabelSelector: selector, TopologyKey: corev1.LabelHostname}
+	zoneTerm := corev1.PodAffinityTerm{LabelSelector: selector, TopologyKey: corev1.LabelTopologyZone}
+
+	tests := []struct {
+		name         string
+		antiAffinity pixiuv1alpha1.AntiAffinityType
+		topologyKey  string
+		affinity     *corev1.Affinity
+		expected     *corev1.Affinity
+	}{
+		{
+			name:         "no anti-affinity",
+			antiAffinity: pixiuv1alpha1.NoAntiAffinity,
+			affinity:     &corev1.Affinity{NodeAffinity: nodeAffinity},
+			expected:     &corev1.Affinity{NodeAffinity: nodeAffinity},
+		},
+		{
+			name:         "soft without affinity",
+			antiAffinity: pixiuv1alpha1.SoftAntiAffinity,
+			expected: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: 100, PodAffinityTerm: hostTerm}},
+			}},
+		},
+		{
+			name:         "hard with node affinity",
+			antiAffinity: pixiuv1alpha1.HardAntiAffinity,
+			affinity:     &corev1.Affinity{NodeAffinity: nodeAffinity},
+			expected: &corev1.Affinity{
+				NodeAffinity:    nodeAffinity,
+				PodAntiAffinity: &corev1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{hostTerm}},
+			},
+		},
+		{
+			name:         "hard with anti-affinity",
+			antiAffinity: pixiuv1alpha1.HardAntiAffinity,
+			topologyKey:  corev1.LabelTopologyZone,
+			affinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution:  []corev1.PodAffinityTerm{cacheTerm},
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: 10, PodAffinityTerm: cacheTerm}},
+			}},
+			expected: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution:  []corev1.PodAffinityTerm{cacheTerm, zoneTerm},
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: 10, PodAffinityTerm: cacheTerm}},
+			}},
+		},
+		{
+			name:         "soft with anti-affinity",
+			antiAffinity: pixiuv1alpha1.SoftAntiAffinity,
+			affinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: 10, PodAffinityTerm: cacheTerm}},
+			}},
+			expected: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+					{Weight: 10, PodAffinityTerm: cacheTerm},
+					{Weight: 100, PodAffinityTerm: hostTerm},
+				},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		ps := newTestPodSet("web", 3, pixiuv1alpha1.RandomPodIdentity)
+		ps.Spec.Selector = selector
+		ps.Spec.AntiAffinity = test.antiAffinity
+		ps.Spec.AntiAffinityTopologyKey = test.topologyKey
+		ps.Spec.Template.Spec.Affinity = test.affinity.DeepCopy()
+		original := ps.Spec.Template.DeepCopy()
+
+		template, err := getPodTemplate(ps, 0, podPlacement{})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(template.Spec.Affinity, test.expected) {
+			t.Errorf("%s: expected affinity %+v, got %+v", test.name, test.expected, template.Spec.Affinity)
+		}
+		// The template of the PodSet is left as is.
+		if !reflect.DeepEqual(&ps.Spec.Template, original) {
+			t.Errorf("%s: expected the PodSet template unchanged, got %+v", test.name, ps.Spec.Template.Spec.Affinity)
+		}
+	}
+}
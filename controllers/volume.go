@@ -0,0 +1,216 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+const (
+	FailedCreateClaimReason     = "FailedCreateClaim"
+	SuccessfulCreateClaimReason = "SuccessfulCreateClaim"
+	SuccessfulDeleteClaimReason = "SuccessfulDeleteClaim"
+)
+
+// getPersistentVolumeClaimName returns the name of the claim created from the given
+// template for the pod of the given ordinal.
+func getPersistentVolumeClaimName(podSet *pixiuv1alpha1.PodSet, template *corev1.PersistentVolumeClaim, ordinal int) string {
+	return fmt.Sprintf("%s-%s", template.Name, getOrdinalPodName(podSet.Name, ordinal))
+}
+
+// getPersistentVolumeClaims returns the claims of the pod of the given ordinal, in
+// the order of the PodSet claim templates.
+func getPersistentVolumeClaims(podSet *pixiuv1alpha1.PodSet, ordinal int) []*corev1.PersistentVolumeClaim {
+	claims := make([]*corev1.PersistentVolumeClaim, 0, len(podSet.Spec.VolumeClaimTemplates))
+	for i := range podSet.Spec.VolumeClaimTemplates {
+		template := &podSet.Spec.VolumeClaimTemplates[i]
+		claim := template.DeepCopy()
+		claim.Name = getPersistentVolumeClaimName(podSet, template, ordinal)
+		claim.Namespace = podSet.Namespace
+		claim.Status = corev1.PersistentVolumeClaimStatus{}
+		if claim.Labels == nil {
+			claim.Labels = make(map[string]string)
+		}
+		if podSet.Spec.Selector != nil {
+			for k, v := range podSet.Spec.Selector.MatchLabels {
+				claim.Labels[k] = v
+			}
+		}
+		claim.Labels[pixiutypes.PodSetNameLabel] = podSet.Name
+		claim.Labels[pixiutypes.PodSetOrdinalLabel] = strconv.Itoa(ordinal)
+		if whenDeleted(podSet) == pixiuv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType {
+			claim.OwnerReferences = append(claim.OwnerReferences, podSetOwnerRef(podSet))
+		}
+		claims = append(claims, claim)
+	}
+	return claims
+}
+
+// updateStorage attaches the claims of its ordinal to the pod, a claim replaces the
+// pod volume with the name of its template.
+func updateStorage(podSet *pixiuv1alpha1.PodSet, pod *corev1.Pod, ordinal int) {
+	templates := podSet.Spec.VolumeClaimTemplates
+	if len(templates) == 0 {
+		return
+	}
+
+	claimed := make(map[string]bool, len(templates))
+	newVolumes := make([]corev1.Volume, 0, len(templates)+len(pod.Spec.Volumes))
+	for i := range templates {
+		claimed[templates[i].Name] = true
+		newVolumes = append(newVolumes, corev1.Volume{
+			Name: templates[i].Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: getPersistentVolumeClaimName(podSet, &templates[i], ordinal),
+				},
+			},
+		})
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if !claimed[volume.Name] {
+			newVolumes = append(newVolumes, volume)
+		}
+	}
+	pod.Spec.Volumes = newVolumes
+}
+
+// createPersistentVolumeClaims makes sure the claims of the pod of the given ordinal
+// exist, existing claims are reused so that the pod gets its volumes back.
+func (r *PodSetReconciler) createPersistentVolumeClaims(ctx context.Context, podSet *pixiuv1alpha1.PodSet, ordinal int) error {
+	for _, claim := range getPersistentVolumeClaims(podSet, ordinal) {
+		existing := &corev1.PersistentVolumeClaim{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name}, existing)
+		if err == nil {
+			if existing.DeletionTimestamp != nil {
+				return fmt.Errorf("claim %s/%s is being deleted", claim.Namespace, claim.Name)
+			}
+			continue
+		}
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get claim %s/%s: %v", claim.Namespace, claim.Name, err)
+		}
+
+		if err = r.Create(ctx, claim); err != nil && !apierrors.IsAlreadyExists(err) {
+			r.Recorder.Eventf(podSet, corev1.EventTypeWarning, FailedCreateClaimReason, "Error creating claim %s: %v", claim.Name, err)
+			return err
+		}
+		r.Recorder.Eventf(podSet, corev1.EventTypeNormal, SuccessfulCreateClaimReason, "Created claim: %v", claim.Name)
+	}
+
+	return nil
+}
+
+// whenDeleted returns the retention policy of the claims when the PodSet is deleted.
+func whenDeleted(podSet *pixiuv1alpha1.PodSet) pixiuv1alpha1.PersistentVolumeClaimRetentionPolicyType {
+	policy := podSet.Spec.PersistentVolumeClaimRetentionPolicy
+	if policy == nil || len(policy.WhenDeleted) == 0 {
+		return pixiuv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType
+	}
+	return policy.WhenDeleted
+}
+
+// whenScaled returns the retention policy of the claims when the PodSet is scaled down.
+func whenScaled(podSet *pixiuv1alpha1.PodSet) pixiuv1alpha1.PersistentVolumeClaimRetentionPolicyType {
+	policy := podSet.Spec.PersistentVolumeClaimRetentionPolicy
+	if policy == nil || len(policy.WhenScaled) == 0 {
+		return pixiuv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType
+	}
+	return policy.WhenScaled
+}
+
+// podSetOwnerRef returns a non controller owner reference to the PodSet, used by the
+// objects which are garbage collected with the PodSet without being controlled by it.
+func podSetOwnerRef(podSet *pixiuv1alpha1.PodSet) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: pixiuv1alpha1.GroupVersion.String(),
+		Kind:       pixiutypes.PodSetKind,
+		Name:       podSet.Name,
+		UID:        podSet.UID,
+	}
+}
+
+// hasOwnerRef returns the index of the owner reference with the given uid, -1 if absent.
+func hasOwnerRef(object metav1.Object, uid types.UID) int {
+	for i, ref := range object.GetOwnerReferences() {
+		if ref.UID == uid {
+			return i
+		}
+	}
+	return -1
+}
+
+// manageClaimRetention applies the retention policy to the existing claims of the
+// PodSet: the claims are owned by the PodSet when they are deleted with it, and the
+// claims of the scaled down ordinals are deleted once their pods are gone.
+func (r *PodSetReconciler) manageClaimRetention(ctx context.Context, pods []corev1.Pod, podSet *pixiuv1alpha1.PodSet) error {
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, claims, client.InNamespace(podSet.Namespace), client.MatchingLabels{pixiutypes.PodSetNameLabel: podSet.Name}); err != nil {
+		return fmt.Errorf("failed to list claims: %v", err)
+	}
+
+	usedOrdinals := make(map[int]bool, len(pods))
+	for i := range pods {
+		if ordinal, ok := getPodOrdinal(&pods[i]); ok {
+			usedOrdinals[ordinal] = true
+		}
+	}
+
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if claim.DeletionTimestamp != nil {
+			continue
+		}
+
+		// A suspended PodSet keeps the claims of its configured replicas.
+		ordinal, err := strconv.Atoi(claim.Labels[pixiutypes.PodSetOrdinalLabel])
+		if err == nil && ordinal >= int(*podSet.Spec.Replicas) && !usedOrdinals[ordinal] &&
+			whenScaled(podSet) == pixiuv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType {
+			if err = r.Delete(ctx, claim); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete claim %s/%s: %v", claim.Namespace, claim.Name, err)
+			}
+			r.Recorder.Eventf(podSet, corev1.EventTypeNormal, SuccessfulDeleteClaimReason, "Deleted claim: %v", claim.Name)
+			continue
+		}
+
+		index := hasOwnerRef(claim, podSet.UID)
+		switch owned := index >= 0; {
+		case whenDeleted(podSet) == pixiuv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType && !owned:
+			claim.OwnerReferences = append(claim.OwnerReferences, podSetOwnerRef(podSet))
+		case whenDeleted(podSet) == pixiuv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType && owned:
+			claim.OwnerReferences = append(claim.OwnerReferences[:index], claim.OwnerReferences[index+1:]...)
+		default:
+			continue
+		}
+		if err = r.Update(ctx, claim); err != nil {
+			return fmt.Errorf("failed to update the owner of claim %s/%s: %v", claim.Namespace, claim.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -26,8 +27,11 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/flowcontrol"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -36,6 +40,9 @@ import (
 	//+kubebuilder:scaffold:imports
 
 	"github.com/caoyingjunz/podset-operator/pkg/metrics"
+	"github.com/caoyingjunz/podset-operator/pkg/migrate"
+	"github.com/caoyingjunz/podset-operator/pkg/ratelimit"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
 )
 
 var (
@@ -53,11 +60,20 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var leaderElectionNamespace string
 	var probeAddr string
 	var disableWebhook bool
+	var podSetBurst, namespaceBurst, clusterBurst int
+	var podSetQPS, namespaceQPS, clusterQPS float64
+	var rebalanceInterval time.Duration
+	var rebalanceMaxSkew int
+	var rebalanceQPS float64
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", true,
@@ -65,6 +81,15 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "The namespace for leader election.")
 	flag.BoolVar(&disableWebhook, "disable-webhook", false, "Disable webhook for controller manager.")
+	flag.IntVar(&podSetBurst, "podset-pod-burst", pixiutypes.DefaultBurstReplicas, "The pod operations a podSet can run at once, unless overridden by spec.burst.")
+	flag.Float64Var(&podSetQPS, "podset-pod-qps", 10, "The pod operations per second refilled for each podSet, 0 to only bound each reconcile by the burst.")
+	flag.IntVar(&namespaceBurst, "namespace-pod-burst", 500, "The pod operations the podSets of a namespace can run at once.")
+	flag.Float64Var(&namespaceQPS, "namespace-pod-qps", 20, "The pod operations per second refilled for each namespace, 0 to disable the namespace limit.")
+	flag.IntVar(&clusterBurst, "cluster-pod-burst", 1000, "The pod operations all the podSets can run at once.")
+	flag.Float64Var(&clusterQPS, "cluster-pod-qps", 50, "The pod operations per second refilled for all the podSets, 0 to disable the cluster limit.")
+	flag.DurationVar(&rebalanceInterval, "rebalance-interval", 0, "The period of the rebalancing of the podSets with a Soft anti-affinity or a topology, 0 to disable the rebalancer.")
+	flag.IntVar(&rebalanceMaxSkew, "rebalance-max-skew", 1, "The difference of pods between the most and the least loaded nodes a podSet tolerates before it is rebalanced.")
+	flag.Float64Var(&rebalanceQPS, "rebalance-qps", 0.1, "The pod evictions per second the rebalancer runs across all the podSets.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -93,15 +118,40 @@ func main() {
 
 	if err = (&controllers.PodSetReconciler{
 		Client:          mgr.GetClient(),
+		APIReader:       mgr.GetAPIReader(),
 		Scheme:          mgr.GetScheme(),
 		Log:             ctrl.Log.WithName("pixiu").WithName("controller"),
 		Recorder:        mgr.GetEventRecorderFor("pixiu"),
 		MetricsProvider: metrics.NewMetricsPodSet(mgr.GetClient()),
+		Governor: ratelimit.NewGovernor(ratelimit.Options{
+			ClusterQPS:     clusterQPS,
+			ClusterBurst:   clusterBurst,
+			NamespaceQPS:   namespaceQPS,
+			NamespaceBurst: namespaceBurst,
+			PodSetQPS:      podSetQPS,
+		}),
+		BurstReplicas: podSetBurst,
+		Backoff:       flowcontrol.NewBackOff(controllers.DefaultCrashLoopBackoff, controllers.MaxCrashLoopBackoff),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PodSet")
 		os.Exit(1)
 	}
 
+	if rebalanceInterval > 0 {
+		if err = mgr.Add(&controllers.Rebalancer{
+			Client:     mgr.GetClient(),
+			KubeClient: kubernetes.NewForConfigOrDie(mgr.GetConfig()),
+			Log:        ctrl.Log.WithName("pixiu").WithName("rebalancer"),
+			Recorder:   mgr.GetEventRecorderFor("pixiu"),
+			Interval:   rebalanceInterval,
+			MaxSkew:    rebalanceMaxSkew,
+			Limiter:    flowcontrol.NewTokenBucketRateLimiter(float32(rebalanceQPS), 1),
+		}); err != nil {
+			setupLog.Error(err, "unable to add rebalancer")
+			os.Exit(1)
+		}
+	}
+
 	if !disableWebhook {
 		// refer to https://kubebuilder.io/cronjob-tutorial/webhook-implementation.html
 		if err = (&pixiuv1alpha1.PodSet{}).SetupWebhookWithManager(mgr); err != nil {
@@ -126,3 +176,49 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runMigrate hands the pods of a Deployment, or of a standalone ReplicaSet, over to an
+// equivalent PodSet, without restarting them.
+func runMigrate(args []string) int {
+	var opts migrate.Options
+	var kubeconfig string
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Paths to a kubeconfig. Only required if out-of-cluster.")
+	fs.StringVar(&opts.Namespace, "namespace", "default", "The namespace of the object to migrate.")
+	fs.StringVar(&opts.Deployment, "deployment", "", "The name of the deployment to migrate.")
+	fs.StringVar(&opts.ReplicaSet, "replicaset", "", "The name of the standalone replicaSet to migrate, instead of a deployment.")
+	fs.StringVar(&opts.PodSet, "podset", "", "The name of the created podSet, defaults to the name of the migrated object.")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Only print the podSet which would be created.")
+	fs.DurationVar(&opts.Timeout, "timeout", 5*time.Minute, "How long to wait for the deployment and its replicaSets to release their dependents.")
+	zapOpts := zap.Options{
+		Development: true,
+	}
+	zapOpts.BindFlags(fs)
+	_ = fs.Parse(args)
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&zapOpts)))
+	migrateLog := ctrl.Log.WithName("migrate")
+	if (len(opts.Deployment) == 0) == (len(opts.ReplicaSet) == 0) {
+		migrateLog.Error(nil, "either the deployment or the replicaSet to migrate is required")
+		return 1
+	}
+	if len(kubeconfig) != 0 {
+		// The kubeconfig flag of controller-runtime is registered on the default flag set.
+		if err := flag.Set("kubeconfig", kubeconfig); err != nil {
+			migrateLog.Error(err, "unable to set kubeconfig")
+			return 1
+		}
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		migrateLog.Error(err, "unable to create client")
+		return 1
+	}
+	m := &migrate.Migrator{Client: c, Log: migrateLog}
+	if err = m.Migrate(ctrl.SetupSignalHandler(), opts); err != nil {
+		migrateLog.Error(err, "migration failed", "deployment", opts.Deployment, "replicaSet", opts.ReplicaSet)
+		return 1
+	}
+	return 0
+}
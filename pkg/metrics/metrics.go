@@ -37,6 +37,14 @@ var (
 			Help: "Number of podSets",
 		},
 	)
+
+	podSetSuspended = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pixiu_podset_suspended",
+			Help: "Whether the podSet is suspended (1) or not (0)",
+		},
+		[]string{"namespace", "name"},
+	)
 )
 
 type metricsPodSet struct {
@@ -49,6 +57,16 @@ func (p *metricsPodSet) HandleMetrics() error {
 		return err
 	}
 	podSetCount.Set(float64(len(podSets.Items)))
+
+	// Reset the vector so that deleted podSets are dropped
+	podSetSuspended.Reset()
+	for _, ps := range podSets.Items {
+		suspended := 0.0
+		if ps.Spec.Suspend != nil && *ps.Spec.Suspend {
+			suspended = 1
+		}
+		podSetSuspended.WithLabelValues(ps.Namespace, ps.Name).Set(suspended)
+	}
 	return nil
 }
 
@@ -57,5 +75,5 @@ func NewMetricsPodSet(c client.Client) MetricsProvider {
 }
 
 func RegisterPodSet() {
-	metrics.Registry.MustRegister(podSetCount)
+	metrics.Registry.MustRegister(podSetCount, podSetSuspended)
 }
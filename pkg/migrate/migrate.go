@@ -0,0 +1,287 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+// Options describes the Deployment, or the standalone ReplicaSet, to migrate to a PodSet.
+type Options struct {
+	// Namespace and Deployment name the Deployment to migrate.
+	Namespace  string
+	Deployment string
+
+	// ReplicaSet names the ReplicaSet to migrate instead of a Deployment.
+	ReplicaSet string
+
+	// PodSet is the name of the created PodSet, defaults to the name of the migrated object.
+	PodSet string
+
+	// DryRun only prints the PodSet which would be created.
+	DryRun bool
+
+	// Timeout bounds the wait for the orphaned objects to be released.
+	Timeout time.Duration
+}
+
+// Migrator hands the pods of a Deployment, or of a standalone ReplicaSet, over to an
+// equivalent PodSet without restarting them. The PodSet is validated by a dry run,
+// then the Deployment and its ReplicaSets are deleted with the Orphan propagation
+// policy, and the PodSet is created and adopts the orphaned pods.
+type Migrator struct {
+	Client client.Client
+	Log    logr.Logger
+}
+
+// Migrate migrates the Deployment, or the ReplicaSet, described by the options to a PodSet.
+func (m *Migrator) Migrate(ctx context.Context, opts Options) error {
+	var podSet *pixiuv1alpha1.PodSet
+	// The objects to delete in order, each one stops reconciling the next ones.
+	var owners []client.Object
+	if len(opts.ReplicaSet) != 0 {
+		replicaSet := &appsv1.ReplicaSet{}
+		if err := m.Client.Get(ctx, types.NamespacedName{Namespace: opts.Namespace, Name: opts.ReplicaSet}, replicaSet); err != nil {
+			return fmt.Errorf("failed to get replicaSet %s/%s: %v", opts.Namespace, opts.ReplicaSet, err)
+		}
+		if ref := metav1.GetControllerOf(replicaSet); ref != nil {
+			return fmt.Errorf("replicaSet %s/%s is controlled by %s %s, migrate it instead", replicaSet.Namespace, replicaSet.Name, ref.Kind, ref.Name)
+		}
+		var err error
+		if podSet, err = NewPodSetFromReplicaSet(replicaSet, opts.PodSet); err != nil {
+			return err
+		}
+		owners = append(owners, replicaSet)
+	} else {
+		deployment := &appsv1.Deployment{}
+		if err := m.Client.Get(ctx, types.NamespacedName{Namespace: opts.Namespace, Name: opts.Deployment}, deployment); err != nil {
+			return fmt.Errorf("failed to get deployment %s/%s: %v", opts.Namespace, opts.Deployment, err)
+		}
+		replicaSets, err := m.getReplicaSets(ctx, deployment)
+		if err != nil {
+			return err
+		}
+		if podSet, err = NewPodSet(deployment, opts.PodSet); err != nil {
+			return err
+		}
+		owners = append(owners, deployment)
+		for i := range replicaSets {
+			owners = append(owners, &replicaSets[i])
+		}
+	}
+
+	if opts.DryRun {
+		data, err := json.MarshalIndent(podSet, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	// Nothing is deleted unless the API server, and the webhooks, accept the PodSet.
+	if err := m.Client.Create(ctx, podSet.DeepCopy(), client.DryRunAll); err != nil {
+		return fmt.Errorf("podSet %s/%s would be rejected: %v", podSet.Namespace, podSet.Name, err)
+	}
+
+	// Stop the Deployment from reconciling its ReplicaSets, then the ReplicaSets from
+	// reconciling the pods. The pods keep running without controller meanwhile.
+	for _, owner := range owners {
+		if err := m.orphanDelete(ctx, owner, opts.Timeout); err != nil {
+			return err
+		}
+	}
+
+	if err := m.Client.Create(ctx, podSet); err != nil {
+		return fmt.Errorf("failed to create podSet %s/%s, its pods are left without controller: %v", podSet.Namespace, podSet.Name, err)
+	}
+	m.Log.Info("Created podSet", "podSet", client.ObjectKeyFromObject(podSet))
+
+	return m.adoptPods(ctx, podSet)
+}
+
+// getReplicaSets returns the ReplicaSets controlled by the Deployment. The migration
+// is refused while a rollout is in progress, that is when more than one ReplicaSet
+// has pods.
+func (m *Migrator) getReplicaSets(ctx context.Context, deployment *appsv1.Deployment) ([]appsv1.ReplicaSet, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of deployment %s/%s: %v", deployment.Namespace, deployment.Name, err)
+	}
+	list := &appsv1.ReplicaSetList{}
+	if err = m.Client.List(ctx, list, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("failed to list replicaSets: %v", err)
+	}
+
+	var replicaSets []appsv1.ReplicaSet
+	active := 0
+	for _, rs := range list.Items {
+		if ref := metav1.GetControllerOf(&rs); ref == nil || ref.UID != deployment.UID {
+			continue
+		}
+		if (rs.Spec.Replicas != nil && *rs.Spec.Replicas > 0) || rs.Status.Replicas > 0 {
+			active++
+		}
+		replicaSets = append(replicaSets, rs)
+	}
+	if active > 1 {
+		return nil, fmt.Errorf("deployment %s/%s has %d active replicaSets, wait for its rollout to complete", deployment.Namespace, deployment.Name, active)
+	}
+	return replicaSets, nil
+}
+
+// orphanDelete deletes the object with the Orphan propagation policy and waits for
+// it to be gone, which happens once the garbage collector released its dependents.
+func (m *Migrator) orphanDelete(ctx context.Context, object client.Object, timeout time.Duration) error {
+	key := client.ObjectKeyFromObject(object)
+	if err := m.Client.Delete(ctx, object, client.PropagationPolicy(metav1.DeletePropagationOrphan),
+		client.Preconditions{UID: uidPtr(object.GetUID())}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %T %s: %v", object, key, err)
+	}
+
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		err := m.Client.Get(ctx, key, object)
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to wait for %T %s to be orphan deleted: %v", object, key, err)
+	}
+	m.Log.Info("Deleted and orphaned dependents", "object", key)
+	return nil
+}
+
+// adoptPods points the controller reference of the orphaned pods matching the PodSet
+// to it, sparing the PodSet controller from creating replacements while its cache
+// catches up. Pods adopted meanwhile by the controller are skipped.
+func (m *Migrator) adoptPods(ctx context.Context, podSet *pixiuv1alpha1.PodSet) error {
+	selector, err := metav1.LabelSelectorAsSelector(podSet.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	pods := &corev1.PodList{}
+	if err = m.Client.List(ctx, pods, client.InNamespace(podSet.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	controllerRef := metav1.NewControllerRef(podSet, pixiuv1alpha1.GroupVersionKind)
+	adopted := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if metav1.GetControllerOf(pod) != nil || pod.DeletionTimestamp != nil {
+			continue
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"ownerReferences": []metav1.OwnerReference{*controllerRef},
+				"uid":             pod.UID,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if err = m.Client.Patch(ctx, pod, client.RawPatch(types.StrategicMergePatchType, patch)); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to adopt pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+		adopted++
+	}
+
+	m.Log.Info("Adopted orphaned pods", "podSet", client.ObjectKeyFromObject(podSet), "pods", adopted)
+	return nil
+}
+
+// NewPodSet returns a PodSet equivalent to the Deployment, selecting its pods.
+func NewPodSet(deployment *appsv1.Deployment, name string) (*pixiuv1alpha1.PodSet, error) {
+	podSet, err := newPodSet("Deployment", &deployment.ObjectMeta, deployment.Spec.Selector, &deployment.Spec.Template, name)
+	if err != nil {
+		return nil, err
+	}
+	podSet.Spec.Replicas = replicasOrDefault(deployment.Spec.Replicas)
+	podSet.Spec.Paused = deployment.Spec.Paused
+	return podSet, nil
+}
+
+// NewPodSetFromReplicaSet returns a PodSet equivalent to the ReplicaSet, selecting its pods.
+func NewPodSetFromReplicaSet(replicaSet *appsv1.ReplicaSet, name string) (*pixiuv1alpha1.PodSet, error) {
+	podSet, err := newPodSet("ReplicaSet", &replicaSet.ObjectMeta, replicaSet.Spec.Selector, &replicaSet.Spec.Template, name)
+	if err != nil {
+		return nil, err
+	}
+	podSet.Spec.Replicas = replicasOrDefault(replicaSet.Spec.Replicas)
+	return podSet, nil
+}
+
+func newPodSet(kind string, meta *metav1.ObjectMeta, selector *metav1.LabelSelector, template *corev1.PodTemplateSpec, name string) (*pixiuv1alpha1.PodSet, error) {
+	if selector == nil {
+		return nil, fmt.Errorf("%s %s/%s has no selector", kind, meta.Namespace, meta.Name)
+	}
+	if len(name) == 0 {
+		name = meta.Name
+	}
+
+	labels := make(map[string]string, len(meta.Labels))
+	for k, v := range meta.Labels {
+		labels[k] = v
+	}
+	return &pixiuv1alpha1.PodSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: pixiuv1alpha1.GroupVersion.String(),
+			Kind:       pixiutypes.PodSetKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: meta.Namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				pixiutypes.PodSetMigratedFromAnnotation: fmt.Sprintf("%s/%s", kind, meta.Name),
+			},
+		},
+		Spec: pixiuv1alpha1.PodSetSpec{
+			Selector: selector.DeepCopy(),
+			Template: *template.DeepCopy(),
+		},
+	}, nil
+}
+
+func replicasOrDefault(replicas *int32) *int32 {
+	value := int32(1)
+	if replicas != nil {
+		value = *replicas
+	}
+	return &value
+}
+
+func uidPtr(uid types.UID) *types.UID {
+	return &uid
+}
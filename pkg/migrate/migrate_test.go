@@ -0,0 +1,334 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pixiuv1alpha1 "github.com/caoyingjunz/podset-operator/api/v1alpha1"
+	pixiutypes "github.com/caoyingjunz/podset-operator/pkg/types"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func newTestDeployment(replicas *int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "deployment", Labels: map[string]string{"app": "web"}},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "nginx"}}},
+			},
+		},
+	}
+}
+
+func newTestReplicaSet(name string, replicas int32, owner metav1.Object) *appsv1.ReplicaSet {
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name), Labels: map[string]string{"app": "web"}},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Template: newTestDeployment(nil).Spec.Template,
+		},
+	}
+	if owner != nil {
+		rs.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(owner, appsv1.SchemeGroupVersion.WithKind("Deployment"))}
+	}
+	return rs
+}
+
+func newTestPod(name string, owner metav1.Object) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			UID:             types.UID(name),
+			Labels:          map[string]string{"app": "web"},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, appsv1.SchemeGroupVersion.WithKind("ReplicaSet"))},
+		},
+	}
+}
+
+func TestNewPodSet(t *testing.T) {
+	paused := newTestDeployment(int32Ptr(3))
+	paused.Spec.Paused = true
+	noSelector := newTestDeployment(nil)
+	noSelector.Spec.Selector = nil
+
+	tests := []struct {
+		name         string
+		deployment   *appsv1.Deployment
+		replicaSet   *appsv1.ReplicaSet
+		podSet       string
+		expectErr    bool
+		expectedName string
+		replicas     int32
+		paused       bool
+		migratedFrom string
+	}{
+		{name: "default replicas", deployment: newTestDeployment(nil), expectedName: "web", replicas: 1, migratedFrom: "Deployment/web"},
+		{name: "paused deployment", deployment: paused, podSet: "web-podset", expectedName: "web-podset", replicas: 3, paused: true, migratedFrom: "Deployment/web"},
+		{name: "deployment without selector", deployment: noSelector, expectErr: true},
+		{name: "replicaSet", replicaSet: newTestReplicaSet("web-1", 2, nil), expectedName: "web-1", replicas: 2, migratedFrom: "ReplicaSet/web-1"},
+	}
+
+	for _, test := range tests {
+		var podSet *pixiuv1alpha1.PodSet
+		var err error
+		var meta *metav1.ObjectMeta
+		var template *corev1.PodTemplateSpec
+		if test.deployment != nil {
+			podSet, err = NewPodSet(test.deployment, test.podSet)
+			meta, template = &test.deployment.ObjectMeta, &test.deployment.Spec.Template
+		} else {
+			podSet, err = NewPodSetFromReplicaSet(test.replicaSet, test.podSet)
+			meta, template = &test.replicaSet.ObjectMeta, &test.replicaSet.Spec.Template
+		}
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if podSet.Name != test.expectedName || podSet.Namespace != "default" {
+			t.Errorf("%s: expected podSet default/%s, got %s/%s", test.name, test.expectedName, podSet.Namespace, podSet.Name)
+		}
+		if *podSet.Spec.Replicas != test.replicas || podSet.Spec.Paused != test.paused {
+			t.Errorf("%s: expected %d replicas and paused %v, got %d and %v", test.name, test.replicas, test.paused, *podSet.Spec.Replicas, podSet.Spec.Paused)
+		}
+		if from := podSet.Annotations[pixiutypes.PodSetMigratedFromAnnotation]; from != test.migratedFrom {
+			t.Errorf("%s: expected migrated from %s, got %s", test.name, test.migratedFrom, from)
+		}
+		if !reflect.DeepEqual(podSet.Spec.Template, *template) || !reflect.DeepEqual(podSet.Labels, meta.Labels) {
+			t.Errorf("%s: expected the template and the labels of the migrated object", test.name)
+		}
+		// The PodSet shares nothing with the migrated object.
+		podSet.Labels["app"] = "other"
+		podSet.Spec.Template.Labels["app"] = "other"
+		if meta.Labels["app"] == "other" || template.Labels["app"] == "other" {
+			t.Errorf("%s: expected the migrated object untouched", test.name)
+		}
+	}
+}
+
+// gcClient orphans the dependents of the objects deleted with the Orphan propagation
+// policy like the garbage collector does, and records the writes in order.
+type gcClient struct {
+	client.Client
+	reject error
+	writes []string
+}
+
+func kindOf(obj client.Object) string {
+	return reflect.TypeOf(obj).Elem().Name()
+}
+
+func (c *gcClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	createOpts := &client.CreateOptions{}
+	createOpts.ApplyOptions(opts)
+	if len(createOpts.DryRun) > 0 {
+		c.writes = append(c.writes, "dry-run create "+kindOf(obj))
+		if c.reject != nil {
+			return c.reject
+		}
+	} else {
+		c.writes = append(c.writes, "create "+kindOf(obj))
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *gcClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	deleteOpts := &client.DeleteOptions{}
+	deleteOpts.ApplyOptions(opts)
+	if deleteOpts.PropagationPolicy == nil || *deleteOpts.PropagationPolicy != metav1.DeletePropagationOrphan {
+		return errors.New("expected the orphan propagation policy")
+	}
+	c.writes = append(c.writes, "delete "+kindOf(obj)+" "+obj.GetName())
+	if err := c.Client.Delete(ctx, obj, opts...); err != nil {
+		return err
+	}
+
+	pods := &corev1.PodList{}
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := c.List(ctx, pods); err != nil {
+		return err
+	}
+	if err := c.List(ctx, replicaSets); err != nil {
+		return err
+	}
+	var dependents []client.Object
+	for i := range pods.Items {
+		dependents = append(dependents, &pods.Items[i])
+	}
+	for i := range replicaSets.Items {
+		dependents = append(dependents, &replicaSets.Items[i])
+	}
+	for _, dependent := range dependents {
+		var refs []metav1.OwnerReference
+		for _, ref := range dependent.GetOwnerReferences() {
+			if ref.UID != obj.GetUID() {
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) == len(dependent.GetOwnerReferences()) {
+			continue
+		}
+		dependent.SetOwnerReferences(refs)
+		if err := c.Update(ctx, dependent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *gcClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.writes = append(c.writes, "patch "+kindOf(obj)+" "+obj.GetName())
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestMigrate(t *testing.T) {
+	deployment := newTestDeployment(int32Ptr(2))
+	replicaSet := newTestReplicaSet("web-1", 2, deployment)
+	oldReplicaSet := newTestReplicaSet("web-0", 0, deployment)
+	activeReplicaSet := newTestReplicaSet("web-0", 1, deployment)
+	standalone := newTestReplicaSet("web-1", 2, nil)
+	rejected := apierrors.NewForbidden(pixiuv1alpha1.GroupVersion.WithResource("podsets").GroupResource(), "web", errors.New("denied by the webhook"))
+
+	tests := []struct {
+		name      string
+		objects   []client.Object
+		opts      Options
+		reject    error
+		expectErr bool
+		writes    []string
+		adopted   []string
+	}{
+		{
+			name:    "deployment",
+			objects: []client.Object{deployment, replicaSet, oldReplicaSet, newTestPod("web-1-a", replicaSet), newTestPod("web-1-b", replicaSet)},
+			opts:    Options{Namespace: "default", Deployment: "web"},
+			writes: []string{
+				"dry-run create PodSet",
+				"delete Deployment web",
+				"delete ReplicaSet web-0",
+				"delete ReplicaSet web-1",
+				"create PodSet",
+				"patch Pod web-1-a",
+				"patch Pod web-1-b",
+			},
+			adopted: []string{"web-1-a", "web-1-b"},
+		},
+		{
+			name:      "rejected podSet",
+			objects:   []client.Object{deployment, replicaSet, newTestPod("web-1-a", replicaSet)},
+			opts:      Options{Namespace: "default", Deployment: "web"},
+			reject:    rejected,
+			expectErr: true,
+			writes:    []string{"dry-run create PodSet"},
+		},
+		{
+			name:      "rollout in progress",
+			objects:   []client.Object{deployment, replicaSet, activeReplicaSet},
+			opts:      Options{Namespace: "default", Deployment: "web"},
+			expectErr: true,
+		},
+		{
+			name:    "standalone replicaSet",
+			objects: []client.Object{standalone, newTestPod("web-1-a", standalone)},
+			opts:    Options{Namespace: "default", ReplicaSet: "web-1", PodSet: "web"},
+			writes: []string{
+				"dry-run create PodSet",
+				"delete ReplicaSet web-1",
+				"create PodSet",
+				"patch Pod web-1-a",
+			},
+			adopted: []string{"web-1-a"},
+		},
+		{
+			name:      "replicaSet of a deployment",
+			objects:   []client.Object{deployment, replicaSet},
+			opts:      Options{Namespace: "default", ReplicaSet: "web-1"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		scheme := runtime.NewScheme()
+		_ = clientgoscheme.AddToScheme(scheme)
+		_ = pixiuv1alpha1.AddToScheme(scheme)
+		objects := make([]client.Object, 0, len(test.objects))
+		for _, obj := range test.objects {
+			objects = append(objects, obj.DeepCopyObject().(client.Object))
+		}
+		c := &gcClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(), reject: test.reject}
+		m := &Migrator{Client: c, Log: logr.Discard()}
+
+		test.opts.Timeout = 5 * time.Second
+		err := m.Migrate(context.TODO(), test.opts)
+		if test.expectErr != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.expectErr, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.writes, test.writes) {
+			t.Errorf("%s: expected writes %v, got %v", test.name, test.writes, c.writes)
+		}
+		if err != nil {
+			// Nothing is deleted when the migration fails early.
+			for _, obj := range test.objects {
+				if err := c.Get(context.TODO(), client.ObjectKeyFromObject(obj), obj.DeepCopyObject().(client.Object)); err != nil {
+					t.Errorf("%s: expected %s %s to remain, got %v", test.name, kindOf(obj), obj.GetName(), err)
+				}
+			}
+		}
+		for _, name := range test.adopted {
+			pod := &corev1.Pod{}
+			if err := c.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: name}, pod); err != nil {
+				t.Errorf("%s: failed to get pod %s: %v", test.name, name, err)
+				continue
+			}
+			ref := metav1.GetControllerOf(pod)
+			if len(pod.OwnerReferences) != 1 || ref == nil || ref.Kind != pixiutypes.PodSetKind || ref.Name != "web" {
+				t.Errorf("%s: expected pod %s adopted by podSet web, got %v", test.name, name, pod.OwnerReferences)
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Options configures the token buckets of a Governor. A qps lower or equal
+// to zero disables the corresponding limit.
+type Options struct {
+	// ClusterQPS and ClusterBurst limit the pod operations of all the podSets.
+	ClusterQPS   float64
+	ClusterBurst int
+
+	// NamespaceQPS and NamespaceBurst limit the pod operations of the podSets in the same namespace.
+	NamespaceQPS   float64
+	NamespaceBurst int
+
+	// PodSetQPS is the refill rate of each podSet, the burst is set per podSet.
+	// Without a refill rate the burst only bounds the operations of a single reconcile.
+	PodSetQPS float64
+}
+
+// bucket is a token bucket refilled at qps tokens per second up to burst tokens.
+type bucket struct {
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(qps float64, burst int, now time.Time) *bucket {
+	return &bucket{qps: qps, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *bucket) enabled() bool {
+	return b != nil && b.qps > 0
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.qps)
+	}
+	b.last = now
+}
+
+// wait returns how long it takes for the bucket to hold one token.
+func (b *bucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.qps * float64(time.Second))
+}
+
+// Governor hands out the pod creations and deletions of all the podSets. It is
+// shared by every reconcile so that podSets scaling at the same time cannot flood
+// the API server or the scheduler.
+type Governor struct {
+	lock sync.Mutex
+	opts Options
+
+	cluster    *bucket
+	namespaces map[string]*bucket
+	podSets    map[string]*bucket
+
+	// now is the clock of the buckets, replaced in tests.
+	now func() time.Time
+}
+
+func NewGovernor(opts Options) *Governor {
+	return &Governor{
+		opts:       opts,
+		cluster:    newBucket(opts.ClusterQPS, opts.ClusterBurst, time.Now()),
+		namespaces: make(map[string]*bucket),
+		podSets:    make(map[string]*bucket),
+		now:        time.Now,
+	}
+}
+
+// Take asks for n pod operations on behalf of the given podSet, whose own bucket
+// holds up to burst tokens. It returns the number of granted operations and, when
+// less than n were granted, how long to wait before asking again.
+func (g *Governor) Take(namespace, name string, burst int, n int) (int, time.Duration) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	now := g.now()
+	key := namespace + "/" + name
+	podSet, ok := g.podSets[key]
+	if !ok {
+		podSet = newBucket(g.opts.PodSetQPS, burst, now)
+		g.podSets[key] = podSet
+	}
+	// The burst of a podSet can be changed at any time
+	podSet.burst = float64(burst)
+
+	ns, ok := g.namespaces[namespace]
+	if !ok {
+		ns = newBucket(g.opts.NamespaceQPS, g.opts.NamespaceBurst, now)
+		g.namespaces[namespace] = ns
+	}
+
+	granted := n
+	if !podSet.enabled() && burst < granted {
+		granted = burst
+	}
+	buckets := []*bucket{g.cluster, ns, podSet}
+	for _, b := range buckets {
+		if !b.enabled() {
+			continue
+		}
+		b.refill(now)
+		if available := int(b.tokens); available < granted {
+			granted = available
+		}
+	}
+	if granted < 0 {
+		granted = 0
+	}
+
+	var retryAfter time.Duration
+	for _, b := range buckets {
+		if !b.enabled() {
+			continue
+		}
+		b.tokens -= float64(granted)
+		if granted < n {
+			if wait := b.wait(); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if granted < n && retryAfter == 0 {
+		retryAfter = time.Second
+	}
+
+	return granted, retryAfter
+}
+
+// Return gives back n operations granted to the given podSet which did not reach the
+// API server, or were rejected by it, so that failing calls do not use up the budget
+// of the working ones.
+func (g *Governor) Return(namespace, name string, n int) {
+	if n <= 0 {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for _, b := range []*bucket{g.cluster, g.namespaces[namespace], g.podSets[namespace+"/"+name]} {
+		if !b.enabled() {
+			continue
+		}
+		b.tokens = math.Min(b.burst, b.tokens+float64(n))
+	}
+}
+
+// Forget drops the bucket of a podSet which no longer exists.
+func (g *Governor) Forget(namespace, name string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	delete(g.podSets, namespace+"/"+name)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Pixiu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock drives the buckets of a Governor in tests.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestGovernor(opts Options, clock *fakeClock) *Governor {
+	g := NewGovernor(opts)
+	g.now = clock.Now
+	g.cluster.last = clock.now
+	return g
+}
+
+type take struct {
+	// after is the time elapsed since the previous take.
+	after     time.Duration
+	namespace string
+	name      string
+	burst     int
+	n         int
+	// giveBack is returned to the governor after the take.
+	giveBack int
+
+	granted    int
+	retryAfter time.Duration
+}
+
+func TestGovernorTake(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		takes []take
+	}{
+		{
+			name: "the burst of a podSet without refill bounds each take",
+			opts: Options{},
+			takes: []take{
+				{namespace: "ns", name: "a", burst: 3, n: 5, granted: 3, retryAfter: time.Second},
+				{namespace: "ns", name: "a", burst: 3, n: 2, granted: 2},
+				{namespace: "ns", name: "a", burst: 3, n: 3, granted: 3},
+			},
+		},
+		{
+			name: "the podSet bucket is refilled at its qps up to its burst",
+			opts: Options{PodSetQPS: 2},
+			takes: []take{
+				{namespace: "ns", name: "a", burst: 4, n: 4, granted: 4},
+				{namespace: "ns", name: "a", burst: 4, n: 1, granted: 0, retryAfter: 500 * time.Millisecond},
+				{after: time.Second, namespace: "ns", name: "a", burst: 4, n: 4, granted: 2, retryAfter: 500 * time.Millisecond},
+				{after: time.Minute, namespace: "ns", name: "a", burst: 4, n: 10, granted: 4, retryAfter: 500 * time.Millisecond},
+			},
+		},
+		{
+			name: "a lowered burst caps the tokens of the podSet",
+			opts: Options{PodSetQPS: 1},
+			takes: []take{
+				{namespace: "ns", name: "a", burst: 10, n: 1, granted: 1},
+				{after: time.Minute, namespace: "ns", name: "a", burst: 2, n: 5, granted: 2, retryAfter: time.Second},
+			},
+		},
+		{
+			name: "the podSets of a namespace share its bucket",
+			opts: Options{NamespaceQPS: 1, NamespaceBurst: 5},
+			takes: []take{
+				{namespace: "ns", name: "a", burst: 4, n: 4, granted: 4},
+				{namespace: "ns", name: "b", burst: 4, n: 4, granted: 1, retryAfter: time.Second},
+				{namespace: "other", name: "c", burst: 4, n: 4, granted: 4},
+				{after: 2 * time.Second, namespace: "ns", name: "b", burst: 4, n: 4, granted: 2, retryAfter: time.Second},
+			},
+		},
+		{
+			name: "the cluster bucket bounds all the namespaces",
+			opts: Options{ClusterQPS: 10, ClusterBurst: 6},
+			takes: []take{
+				{namespace: "ns", name: "a", burst: 4, n: 4, granted: 4},
+				{namespace: "other", name: "b", burst: 4, n: 4, granted: 2, retryAfter: 100 * time.Millisecond},
+				{after: 300 * time.Millisecond, namespace: "other", name: "b", burst: 4, n: 4, granted: 3, retryAfter: 100 * time.Millisecond},
+			},
+		},
+		{
+			name: "the retry waits for the slowest bucket",
+			opts: Options{ClusterQPS: 10, ClusterBurst: 2, NamespaceQPS: 1, NamespaceBurst: 2},
+			takes: []take{
+				{namespace: "ns", name: "a", burst: 4, n: 3, granted: 2, retryAfter: time.Second},
+			},
+		},
+		{
+			name: "the failed operations are given back",
+			opts: Options{ClusterQPS: 1, ClusterBurst: 4, NamespaceQPS: 1, NamespaceBurst: 4, PodSetQPS: 1},
+			takes: []take{
+				{namespace: "ns", name: "a", burst: 4, n: 4, granted: 4, giveBack: 3},
+				{namespace: "ns", name: "a", burst: 4, n: 4, granted: 3, retryAfter: time.Second},
+				// Given back tokens never exceed the burst.
+				{after: time.Minute, namespace: "ns", name: "a", burst: 4, n: 1, granted: 1, giveBack: 10},
+				{namespace: "ns", name: "a", burst: 4, n: 5, granted: 4, retryAfter: time.Second},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+			g := newTestGovernor(test.opts, clock)
+			for i, tk := range test.takes {
+				clock.now = clock.now.Add(tk.after)
+				granted, retryAfter := g.Take(tk.namespace, tk.name, tk.burst, tk.n)
+				if granted != tk.granted || retryAfter != tk.retryAfter {
+					t.Errorf("take %d: expected %d granted, retry after %v, got %d, %v", i, tk.granted, tk.retryAfter, granted, retryAfter)
+				}
+				g.Return(tk.namespace, tk.name, tk.giveBack)
+			}
+		})
+	}
+}
+
+func TestGovernorForget(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	g := newTestGovernor(Options{PodSetQPS: 1}, clock)
+	if granted, _ := g.Take("ns", "a", 2, 2); granted != 2 {
+		t.Fatalf("expected 2 granted, got %d", granted)
+	}
+	g.Forget("ns", "a")
+	if granted, _ := g.Take("ns", "a", 2, 2); granted != 2 {
+		t.Errorf("expected a full bucket once forgotten, got %d granted", granted)
+	}
+}
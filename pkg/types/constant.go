@@ -19,5 +19,44 @@ package types
 const (
 	PodSetKind = "PodSet"
 
-	BurstReplicas = 500
+	// PodSetNameLabel records the name of the PodSet which created an object.
+	PodSetNameLabel = "podset.pixiu.io/name"
+
+	// PodSetOrdinalLabel records the index of a pod within its PodSet, which is the
+	// stable ordinal of the pods of an ordinal PodSet.
+	PodSetOrdinalLabel = "podset.pixiu.io/ordinal"
+
+	// PodSetReplicasAnnotation records the replicas of the PodSet when a pod was created.
+	PodSetReplicasAnnotation = "podset.pixiu.io/replicas"
+
+	// PodSetRevisionLabel records the revision of the template a pod was created from.
+	PodSetRevisionLabel = "podset.pixiu.io/revision"
+
+	// PodSetPatchRevisionLabel records the revision of the overrides and of the subset
+	// patch a pod was created with, the pods are rolled when it changes.
+	PodSetPatchRevisionLabel = "podset.pixiu.io/patch-revision"
+
+	// PodSetTopologyDomainLabel records the topology domain a pod is pinned to.
+	PodSetTopologyDomainLabel = "podset.pixiu.io/topology-domain"
+
+	// PodSetSubsetLabel records the subset of a PodSet a pod belongs to.
+	PodSetSubsetLabel = "podset.pixiu.io/subset"
+
+	// PodGroupLabel records the PodGroup of the coscheduling plugin a pod belongs to.
+	PodGroupLabel = "pod-group.scheduling.sigs.k8s.io"
+
+	// PodSetMigratedFromAnnotation records the object a PodSet was migrated from.
+	PodSetMigratedFromAnnotation = "podset.pixiu.io/migrated-from"
+
+	// PodSetFinalizer holds the deletion of a PodSet until its pods are handled as
+	// requested by its deletion policy.
+	PodSetFinalizer = "podset.pixiu.io/finalizer"
+
+	// The environment variables injected in every container of the PodSet pods.
+	PodSetIndexEnv    = "PODSET_INDEX"
+	PodSetReplicasEnv = "PODSET_REPLICAS"
+	PodSetNameEnv     = "PODSET_NAME"
+
+	// DefaultBurstReplicas is the default number of pods of a podSet created or deleted at once.
+	DefaultBurstReplicas = 500
 )
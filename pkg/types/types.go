@@ -28,4 +28,53 @@ const (
 	MinimumReplicasAvailable = "MinimumReplicasAvailable"
 
 	MinimumReplicasUnavailable = "MinimumReplicasUnavailable"
+
+	// PodSetSuspended is added in a podSet while it is suspended and scaled to zero.
+	PodSetSuspended string = "Suspended"
+
+	// SuspendedReason is the reason of the Suspended condition.
+	SuspendedReason = "PodSetSuspended"
+
+	// PodSetThrottled is added in a podSet while its pod creations or deletions are
+	// held back by the rate limits.
+	PodSetThrottled string = "Throttled"
+
+	// RateLimitedReason is the reason of the Throttled condition.
+	RateLimitedReason = "RateLimited"
+
+	// CrashLoopingReason is the reason of the PodSetFailure condition while the pods
+	// of a podSet keep failing, their replacement is backed off meanwhile.
+	CrashLoopingReason = "CrashLooping"
+
+	// The reasons of the PodSetFailure condition when the API server rejects the pods
+	// of a podSet, for an exceeded quota, a limit range, another admission plugin,
+	// an invalid pod or a terminating namespace.
+	QuotaExceededReason        = "QuotaExceeded"
+	LimitRangeViolatedReason   = "LimitRangeViolated"
+	AdmissionForbiddenReason   = "AdmissionForbidden"
+	InvalidPodReason           = "InvalidPod"
+	NamespaceTerminatingReason = "NamespaceTerminating"
+
+	// PodSetTerminating is added in a podSet while its teardown is in progress.
+	PodSetTerminating string = "Terminating"
+
+	// RunningPreDeleteHookReason is the reason of the Terminating condition while
+	// the pre-delete hook runs.
+	RunningPreDeleteHookReason = "RunningPreDeleteHook"
+
+	// TearingDownReason is the reason of the Terminating condition while the pods
+	// are drained.
+	TearingDownReason = "TearingDown"
+
+	// PodSetGangScheduled is added in a gang scheduled podSet, true while enough of
+	// its pods are running.
+	PodSetGangScheduled string = "GangScheduled"
+
+	// The reasons of the GangScheduled condition, while the gang runs, while it waits
+	// for its pods to run, once it was torn down for not running in time, and while
+	// the podSet has no replicas.
+	GangRunningReason    = "GangRunning"
+	WaitingForGangReason = "WaitingForGang"
+	GangTimeoutReason    = "GangTimeout"
+	GangScaledDownReason = "ScaledDown"
 )